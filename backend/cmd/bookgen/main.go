@@ -0,0 +1,174 @@
+// Command bookgen builds the bot's opening book offline. It enumerates every
+// position up to the given ply, scores each legal column with the solver or
+// the bot search, and writes the result in the binary book format.
+//
+//	go run ./cmd/bookgen -ply 4 -engine search -depth 10 -out internal/bot/openings.book
+package main
+
+import (
+	"connect-four/internal/bot"
+	"connect-four/internal/game"
+	"connect-four/internal/solver"
+	"flag"
+	"log"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+type job struct {
+	g *game.Game
+}
+
+type result struct {
+	g     *game.Game
+	moves []bot.BookMove
+}
+
+func main() {
+	ply := flag.Int("ply", 4, "include positions with up to this many discs")
+	engine := flag.String("engine", "search", "engine used to score moves: search or solver")
+	depth := flag.Int("depth", 10, "search depth when -engine=search")
+	out := flag.String("out", "openings.book", "output file")
+	workers := flag.Int("workers", runtime.NumCPU(), "parallel workers")
+	flag.Parse()
+
+	if *engine != "search" && *engine != "solver" {
+		log.Fatalf("Unknown engine %q", *engine)
+	}
+
+	positions := enumerate(*ply)
+	log.Printf("Scoring %d positions up to ply %d with %s using %d workers...", len(positions), *ply, *engine, *workers)
+
+	jobs := make(chan job)
+	results := make(chan result)
+	var wg sync.WaitGroup
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			score := newScorer(*engine, *depth)
+			for j := range jobs {
+				results <- result{g: j.g, moves: score(j.g)}
+			}
+		}()
+	}
+	go func() {
+		for _, g := range positions {
+			jobs <- job{g: g}
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	start := time.Now()
+	book := bot.NewBook(*ply)
+	done := 0
+	for r := range results {
+		book.Add(r.g, r.moves)
+		done++
+		if done%100 == 0 {
+			log.Printf("%d/%d positions (%s)", done, len(positions), time.Since(start).Round(time.Second))
+		}
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatalf("Error creating book: %v", err)
+	}
+	defer f.Close()
+
+	n, err := book.WriteTo(f)
+	if err != nil {
+		log.Fatalf("Error writing book: %v", err)
+	}
+	log.Printf("Wrote %d positions (%d bytes) to %s in %s", book.Len(), n, *out, time.Since(start).Round(time.Second))
+}
+
+// enumerate returns one game per distinct position with at most maxPly discs,
+// skipping positions that are already won.
+func enumerate(maxPly int) []*game.Game {
+	root := game.NewGame("book", game.Player{ID: "first"})
+	root.AddPlayer(game.Player{ID: "second"})
+	root.SetPosition(root.Board, 0)
+
+	seen := map[uint64]bool{}
+	var positions []*game.Game
+	var walk func(g *game.Game, ply int)
+	walk = func(g *game.Game, ply int) {
+		key := bot.BookKey(g)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		positions = append(positions, g)
+
+		if ply == maxPly {
+			return
+		}
+		for col := 0; col < g.Size.Columns; col++ {
+			child := g.Clone()
+			if _, _, err := child.MakeMove(col); err != nil || child.Status != "playing" {
+				continue
+			}
+			walk(child, ply+1)
+		}
+	}
+	walk(root, 0)
+	return positions
+}
+
+// newScorer returns a function scoring every legal column of a position from
+// the side to move's point of view, best first. Each worker gets its own
+// scorer because bots and solvers aren't safe for concurrent use.
+func newScorer(engine string, depth int) func(g *game.Game) []bot.BookMove {
+	if engine == "solver" {
+		s := solver.NewSolver()
+		return func(g *game.Game) []bot.BookMove {
+			p, err := solver.FromGame(g)
+			if err != nil {
+				log.Fatalf("Error converting position: %v", err)
+			}
+			scores, ok := s.ScoreMoves(p)
+			var moves []bot.BookMove
+			for col := 0; col < solver.Width; col++ {
+				if ok[col] {
+					moves = append(moves, bot.BookMove{Column: col, Score: scores[col].Score})
+				}
+			}
+			return sortMoves(moves)
+		}
+	}
+
+	b := bot.NewBotWithDifficulty(bot.Expert)
+	b.Book = nil
+	return func(g *game.Game) []bot.BookMove {
+		var moves []bot.BookMove
+		for col := 0; col < g.Size.Columns; col++ {
+			child := g.Clone()
+			if _, _, err := child.MakeMove(col); err != nil {
+				continue
+			}
+
+			score := 0
+			switch {
+			case child.Status == "finished" && child.Winner == g.CurrentPlayer:
+				score = bot.WinScore - 1
+			case child.Status == "finished":
+				score = 0 // Draw
+			default:
+				score = -b.Search(child, depth-1).Score
+			}
+			moves = append(moves, bot.BookMove{Column: col, Score: score})
+		}
+		return sortMoves(moves)
+	}
+}
+
+func sortMoves(moves []bot.BookMove) []bot.BookMove {
+	sort.SliceStable(moves, func(i, j int) bool { return moves[i].Score > moves[j].Score })
+	return moves
+}
@@ -0,0 +1,177 @@
+// Command refengine is a reference implementation of the external engine
+// protocol (see internal/bot/protocol.go) backed by the built-in bot. It is
+// useful for checking the server's process handling and as a starting point
+// for engines written in other languages.
+//
+//	go build -o refengine ./cmd/refengine
+//	EXTERNAL_ENGINES="ref=./refengine" go run ./cmd/server
+//
+// Without -engine it plays with the alpha-beta bot; "-engine mcts" switches
+// to Monte Carlo Tree Search.
+package main
+
+import (
+	"bufio"
+	"connect-four/internal/bot"
+	"connect-four/internal/game"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type engine struct {
+	name       string
+	difficulty bot.Difficulty
+	player     bot.Engine
+	position   *game.Game
+
+	out    sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func main() {
+	name := flag.String("engine", bot.EngineAlphaBeta, "built-in engine to play with")
+	flag.Parse()
+
+	log.SetOutput(os.Stderr)
+	log.SetPrefix("refengine: ")
+	log.SetFlags(0)
+
+	if _, err := bot.DefaultRegistry.Parse(*name); err != nil {
+		log.Fatal(err)
+	}
+	e := &engine{name: *name, difficulty: bot.DefaultDifficulty}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "quit" {
+			e.stop()
+			return
+		}
+		e.handle(fields[0], fields[1:])
+	}
+	e.stop()
+}
+
+func (e *engine) handle(command string, args []string) {
+	switch command {
+	case "c4ep":
+		e.send("id name refengine (" + e.name + ")")
+		e.send("c4epok")
+	case "option":
+		if len(args) == 2 && args[0] == "difficulty" {
+			difficulty, err := bot.ParseDifficulty(args[1])
+			if err != nil {
+				log.Printf("Ignoring option: %v", err)
+				return
+			}
+			e.difficulty = difficulty
+			e.player = nil
+		}
+	case "isready":
+		e.wait()
+		e.send("readyok")
+	case "newgame":
+		e.stop()
+		e.player = nil
+		e.position = nil
+	case "position":
+		e.stop()
+		g, err := bot.DecodePosition(args)
+		if err != nil {
+			log.Printf("Bad position: %v", err)
+			return
+		}
+		e.position = g
+	case "go":
+		e.goSearch(args)
+	case "stop":
+		e.stop()
+	default:
+		log.Printf("Unknown command %q", command)
+	}
+}
+
+// goSearch starts thinking in the background so "stop" can interrupt it.
+func (e *engine) goSearch(args []string) {
+	e.stop()
+	if e.position == nil {
+		log.Printf("go without position")
+		e.send("bestmove 0")
+		return
+	}
+
+	var clock bot.Clock
+	for i := 0; i+1 < len(args); i += 2 {
+		ms, err := strconv.Atoi(args[i+1])
+		if err != nil {
+			log.Printf("Bad %s value %q", args[i], args[i+1])
+			continue
+		}
+		d := time.Duration(ms) * time.Millisecond
+		switch args[i] {
+		case "movetime":
+			clock.MoveTime = d
+		case "wtime":
+			clock.Remaining = d
+		case "winc":
+			clock.Increment = d
+		}
+	}
+
+	if e.player == nil {
+		player, err := bot.DefaultRegistry.New(e.name, e.difficulty)
+		if err != nil {
+			log.Fatal(err)
+		}
+		e.player = player
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	e.cancel = cancel
+	e.done = done
+	go func(player bot.Engine, g *game.Game) {
+		defer close(done)
+		move, err := player.ChooseMove(ctx, g, clock)
+		if err != nil {
+			log.Printf("No move: %v", err)
+			e.send("bestmove 0")
+			return
+		}
+		e.send("bestmove " + bot.EncodeMove(move))
+	}(e.player, e.position)
+}
+
+// stop interrupts the current search, if any, and waits for its bestmove.
+func (e *engine) stop() {
+	if e.cancel != nil {
+		e.cancel()
+		e.cancel = nil
+	}
+	e.wait()
+}
+
+func (e *engine) wait() {
+	if e.done != nil {
+		<-e.done
+		e.done = nil
+	}
+}
+
+func (e *engine) send(line string) {
+	e.out.Lock()
+	defer e.out.Unlock()
+	fmt.Fprintln(os.Stdout, line)
+}
@@ -1,14 +1,24 @@
 package main
 
 import (
+	"connect-four/internal/bot"
 	"connect-four/internal/database"
 	"connect-four/internal/game"
+	"connect-four/internal/rating"
+	"connect-four/internal/review"
 	"connect-four/internal/websockethub"  // Use the renamed package
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"io"
 	"log"
 	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -47,13 +57,94 @@ func NewServer() *Server {
 		}
 	}
 
+	hub := websockethub.NewHub()
+	hub.BotMinDelay = durationFromEnv("BOT_MIN_DELAY", hub.BotMinDelay)
+	hub.BotThinkTime = durationFromEnv("BOT_THINK_TIME", hub.BotThinkTime)
+	hub.MatchTimeout = durationFromEnv("MATCH_TIMEOUT", hub.MatchTimeout)
+	hub.GracePeriod = durationFromEnv("RECONNECT_GRACE", hub.GracePeriod)
+	registerExternalEngines(hub.Engines, os.Getenv("EXTERNAL_ENGINES"))
+	// Finished games and the leaderboards need the database
+	if store != nil {
+		hub.GameStore = store
+	}
+
+	// Reviews go to the database when there is one
+	var reviews review.Store = review.NewMemoryStore(1000)
+	if store != nil {
+		reviews = store
+	}
+	hub.Reviewer = review.NewReviewer(reviews, intFromEnv("REVIEW_WORKERS", 2), 64)
+
+	var ratings rating.Store = rating.NewMemoryStore()
+	if store != nil {
+		ratings = store
+	}
+	hub.Ratings = rating.New(ratings)
+	hub.RatingWindow = intFromEnv("RATING_WINDOW", hub.RatingWindow)
+	hub.WindowGrowth = intFromEnv("RATING_WINDOW_GROWTH", hub.WindowGrowth)
+
 	return &Server{
-		hub:   websockethub.NewHub(),
+		hub:   hub,
 		store: store,
 	}
 }
 
+// durationFromEnv parses a duration such as "500ms" from the environment
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Warning: invalid %s %q, using %s", key, value, fallback)
+		return fallback
+	}
+	return d
+}
+
+// intFromEnv parses a number from the environment
+func intFromEnv(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		log.Printf("Warning: invalid %s %q, using %d", key, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+// registerExternalEngines registers the engine programs listed in
+// EXTERNAL_ENGINES, e.g. "ref=./refengine -engine mcts;other=./other".
+func registerExternalEngines(registry *bot.Registry, spec string) {
+	configs, err := bot.ParseExternalSpec(spec)
+	if err != nil {
+		log.Printf("Warning: ignoring EXTERNAL_ENGINES: %v", err)
+		return
+	}
+	for name, config := range configs {
+		bot.RegisterExternal(registry, name, config)
+		log.Printf("Registered external engine %s: %s", name, config.Path)
+	}
+}
+
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	// A player coming back to their game takes their seat with its session
+	// token
+	var seatGameID string
+	var seatPlayer game.Player
+	if token := r.URL.Query().Get("session"); token != "" {
+		var err error
+		seatGameID, seatPlayer, err = s.hub.Session(token)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println(err)
@@ -65,10 +156,24 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		Conn:     conn,
 		Send:     make(chan []byte, 256),
 		PlayerID: r.URL.Query().Get("username") + "_" + generatePlayerID(),
+		Username: r.URL.Query().Get("username"),
 		GameID:   r.URL.Query().Get("gameId"),
 	}
+	if seatGameID != "" {
+		client.PlayerID = seatPlayer.ID
+		client.Username = seatPlayer.Username
+		client.GameID = seatGameID
+	}
 
 	s.hub.Register <- client
+	s.hub.AttachSeat(client, client.GameID)
+	// Catch up on anything that happened since the game was created, such
+	// as being matched with an opponent
+	if client.GameID != "" {
+		if err := s.hub.Watch(client, client.GameID); err != nil {
+			log.Printf("Watch error: %v", err)
+		}
+	}
 
 	// Start goroutines for this client
 	go client.WritePump()
@@ -82,7 +187,16 @@ func (s *Server) handleCreateGame(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Username string `json:"username"`
+		Username      string `json:"username"`
+		BotDifficulty string `json:"botDifficulty"`
+		BotEngine     string `json:"botEngine"`
+		Mode          string `json:"mode"`
+		Variant       string `json:"variant"`
+		Rows          int    `json:"rows"`
+		Columns       int    `json:"columns"`
+		Connect       int    `json:"connect"`
+		Position      string `json:"position"`
+		Moves         string `json:"moves"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -90,18 +204,323 @@ func (s *Server) handleCreateGame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Without a difficulty the bot is picked to match the player's rating
+	var difficulty bot.Difficulty
+	if req.BotDifficulty != "" {
+		d, err := bot.ParseDifficulty(req.BotDifficulty)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		difficulty = d
+	}
+
+	engine, err := s.hub.Engines.Parse(req.BotEngine)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mode, err := game.ParseMode(req.Mode)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	variant, err := game.ParseVariant(req.Variant)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	size, err := game.ParseVariantSize(variant, req.Rows, req.Columns, req.Connect)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	player := game.Player{
 		ID:       generatePlayerID(),
 		Username: req.Username,
 		IsBot:    false,
 	}
 
-	game := s.hub.CreateGame(player)
+	settings := game.Settings{
+		BotDifficulty: string(difficulty),
+		BotEngine:     engine,
+		Mode:          mode,
+		Variant:       variant,
+	}
+
+	if req.Position == "" && req.Moves == "" {
+		game := s.hub.CreateGame(player, settings, size)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(seatResponse{game, s.hub.SessionToken(game.ID, player.ID)})
+		return
+	}
+
+	start, err := startPosition(req.Position, req.Moves, size, variant)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if (req.Rows != 0 || req.Columns != 0 || req.Connect != 0) && start.Size != size {
+		http.Error(w, "size doesn't match the position", http.StatusBadRequest)
+		return
+	}
+	if req.Variant != "" && start.Variant != variant {
+		http.Error(w, "variant doesn't match the position", http.StatusBadRequest)
+		return
+	}
+	game, err := s.hub.CreateGameFromPosition(player, settings, start)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(seatResponse{game, s.hub.SessionToken(game.ID, player.ID)})
+}
+
+// seatResponse is a game with the session token of the seat the caller took
+type seatResponse struct {
+	*game.Game
+	SessionToken string `json:"sessionToken"`
+}
+
+// handleJoinGame seats a second player in a waiting game, which starts it.
+// The new player is the game's second seat.
+func (s *Server) handleJoinGame(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		GameID   string `json:"gameId"`
+		Username string `json:"username"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.GameID == "" {
+		http.Error(w, "gameId is required", http.StatusBadRequest)
+		return
+	}
+	if req.Username == "" {
+		http.Error(w, "username is required", http.StatusBadRequest)
+		return
+	}
+
+	player := game.Player{
+		ID:       generatePlayerID(),
+		Username: req.Username,
+	}
+
+	game, err := s.hub.JoinGame(req.GameID, player)
+	switch err {
+	case nil:
+	case websockethub.ErrGameNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case websockethub.ErrGameFull, websockethub.ErrGameStarted:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(seatResponse{game, s.hub.SessionToken(game.ID, player.ID)})
+}
+
+// startPosition plays moves (move notation) from position (position
+// notation). An empty position is the variant's starting board of the given
+// size with the first player to move.
+func startPosition(position, moves string, size game.Size, variant string) (game.Position, error) {
+	rules, _ := game.LookupRules(variant)
+	start := game.Position{Size: size, Board: rules.Setup(size), Variant: variant}
+	if position != "" {
+		var err error
+		if start, err = game.ParsePosition(position); err != nil {
+			return start, err
+		}
+	}
+	actions, err := game.ParseMoves(moves)
+	if err != nil {
+		return start, err
+	}
+	return start.Play(actions)
+}
+
+// handleRecord downloads a finished game as text: tags, then its moves in
+// move notation.
+func (s *Server) handleRecord(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	gameID := r.URL.Query().Get("gameId")
+	if gameID == "" {
+		http.Error(w, "gameId is required", http.StatusBadRequest)
+		return
+	}
+
+	record, err := s.hub.Record(gameID)
+	if err == websockethub.ErrGameNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+gameID+`.txt"`)
+	io.WriteString(w, record)
+}
+
+// handleBotMatch starts a game between two bots for clients to watch
+func (s *Server) handleBotMatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		BotDifficulties [2]string `json:"botDifficulties"`
+		BotEngines      [2]string `json:"botEngines"`
+		Variant         string    `json:"variant"`
+		Rows            int       `json:"rows"`
+		Columns         int       `json:"columns"`
+		Connect         int       `json:"connect"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	var levels, engines [2]string
+	for seat := 0; seat < 2; seat++ {
+		difficulty, err := bot.ParseDifficulty(req.BotDifficulties[seat])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		engine, err := s.hub.Engines.Parse(req.BotEngines[seat])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		levels[seat] = string(difficulty)
+		engines[seat] = engine
+	}
+
+	variant, err := game.ParseVariant(req.Variant)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	size, err := game.ParseVariantSize(variant, req.Rows, req.Columns, req.Connect)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	game := s.hub.CreateBotMatch(levels, engines, game.Settings{Mode: game.ModeCasual, Variant: variant}, size)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(game)
 }
 
+// handleAnalysis evaluates every column of a game in progress (for one of its
+// players, outside rated games) or of an arbitrary board.
+func (s *Server) handleAnalysis(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		SessionToken  string  `json:"sessionToken"` // of the player's seat
+		Board         [][]int `json:"board"`
+		CurrentPlayer int     `json:"currentPlayer"`
+		Connect       int     `json:"connect"` // 4 when left out
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	var analysis *bot.Analysis
+	var err error
+	if req.SessionToken != "" {
+		gameID, player, sessionErr := s.hub.Session(req.SessionToken)
+		if sessionErr != nil {
+			http.Error(w, sessionErr.Error(), http.StatusUnauthorized)
+			return
+		}
+		analysis, err = s.hub.Hint(r.Context(), gameID, player.ID)
+	} else {
+		if len(req.Board) == 0 {
+			http.Error(w, "board is required", http.StatusBadRequest)
+			return
+		}
+		var size game.Size
+		size, err = game.ParseSize(len(req.Board), len(req.Board[0]), req.Connect)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// The bot checks the board's shape and contents against size
+		g := &game.Game{Size: size, Board: req.Board, CurrentPlayer: req.CurrentPlayer, Status: "playing"}
+		analysis, err = s.hub.Analyze(r.Context(), g)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(analysis)
+}
+
+// handleReview returns the annotated record of a finished game. Reviews take
+// a while to compute, so a game that just ended may not have one yet.
+func (s *Server) handleReview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	gameID := r.URL.Query().Get("gameId")
+	if gameID == "" {
+		http.Error(w, "gameId is required", http.StatusBadRequest)
+		return
+	}
+
+	result, err := s.hub.Reviewer.Get(gameID)
+	if err == review.ErrNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
 func (s *Server) handleLeaderboard(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -115,7 +534,13 @@ func (s *Server) handleLeaderboard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	entries, err := s.store.GetLeaderboard()
+	var entries []database.LeaderboardEntry
+	var err error
+	if level := r.URL.Query().Get("botLevel"); level != "" {
+		entries, err = s.store.GetBotLeaderboard(level)
+	} else {
+		entries, err = s.store.GetLeaderboard()
+	}
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -148,6 +573,11 @@ func main() {
 	http.Handle("/health", c.Handler(http.HandlerFunc(server.handleHealth)))
 	http.Handle("/ws", c.Handler(http.HandlerFunc(server.handleWebSocket)))
 	http.Handle("/game/create", c.Handler(http.HandlerFunc(server.handleCreateGame)))
+	http.Handle("/game/join", c.Handler(http.HandlerFunc(server.handleJoinGame)))
+	http.Handle("/analysis", c.Handler(http.HandlerFunc(server.handleAnalysis)))
+	http.Handle("/game/bot-match", c.Handler(http.HandlerFunc(server.handleBotMatch)))
+	http.Handle("/game/review", c.Handler(http.HandlerFunc(server.handleReview)))
+	http.Handle("/game/record", c.Handler(http.HandlerFunc(server.handleRecord)))
 	http.Handle("/leaderboard", c.Handler(http.HandlerFunc(server.handleLeaderboard)))
 
 	// Get port from environment (Render provides this)
@@ -158,10 +588,31 @@ func main() {
 
 	// Bind to 0.0.0.0 for Render deployment
 	addr := "0.0.0.0:" + port
+	srv := &http.Server{Addr: addr}
+
+	// Stop bot searches and drain connections on SIGINT/SIGTERM
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		<-stop
+
+		log.Printf("Shutting down...")
+		server.hub.Shutdown()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}()
+
 	log.Printf("🚀 Server starting on %s", addr)
-	log.Fatal(http.ListenAndServe(addr, nil))
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
 }
 
+// generatePlayerID returns a random ID. Player IDs are public, so they only
+// need to be unique: a seat is proven with its session token.
 func generatePlayerID() string {
-	return string(rune(rand.Intn(10000)))
+	b := make([]byte, 8)
+	crand.Read(b)
+	return hex.EncodeToString(b)
 }
\ No newline at end of file
@@ -0,0 +1,146 @@
+// Command solverbench times the solver on a suite of positions with known
+// scores and fails if any result is wrong or slower than the limit.
+//
+//	go run ./cmd/solverbench
+//	go run ./cmd/solverbench -file positions.txt -limit 10s
+//
+// A positions file has one position per line: a sequence of 1-based column
+// digits followed by the expected score, e.g. "4453 -2".
+package main
+
+import (
+	"bufio"
+	"connect-four/internal/solver"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type benchPosition struct {
+	Name     string
+	Sequence string
+	Score    int
+}
+
+// The first three are from the end-game test sets published with Pascal
+// Pons' solver; the rest are common openings after 5 to 10 plies.
+var defaultPositions = []benchPosition{
+	{"end game 1", "2252576253462244111563365343671351441", -1},
+	{"end game 2", "7422341735647741166133573473242566", 1},
+	{"end game 3", "23163416124767223154467471272416755633", 0},
+	{"opening 5 plies", "44344", 2},
+	{"opening 8 plies a", "73217546", 3},
+	{"opening 8 plies b", "52575425", 4},
+	{"opening 8 plies c", "17164347", 8},
+	{"opening 10 plies a", "2427531475", 3},
+	{"opening 10 plies b", "4711657471", 4},
+	{"opening 12 plies", "761214645726", 3},
+}
+
+func main() {
+	file := flag.String("file", "", "positions file (default: built-in suite)")
+	limit := flag.Duration("limit", 10*time.Second, "maximum time allowed per position")
+	weak := flag.Bool("weak", false, "only prove win/draw/loss, not the distance")
+	flag.Parse()
+
+	positions := defaultPositions
+	if *file != "" {
+		var err error
+		positions, err = loadPositions(*file)
+		if err != nil {
+			log.Fatalf("Error loading positions: %v", err)
+		}
+	}
+
+	s := solver.NewSolver()
+	failed := 0
+	var total time.Duration
+	var totalNodes int64
+
+	fmt.Printf("%-20s %-40s %6s %6s %12s %12s\n", "position", "moves", "want", "got", "nodes", "time")
+	for _, bp := range positions {
+		p := solver.NewPosition()
+		if n := p.PlaySequence(bp.Sequence); n != len(bp.Sequence) {
+			log.Fatalf("Invalid sequence %q at move %d", bp.Sequence, n+1)
+		}
+
+		s.Reset()
+		start := time.Now()
+		var result solver.Result
+		if *weak {
+			result = s.WeakSolve(p)
+		} else {
+			result = s.Solve(p)
+		}
+		elapsed := time.Since(start)
+		total += elapsed
+		totalNodes += s.Nodes()
+
+		want := bp.Score
+		got := result.Score
+		if *weak {
+			want, got = sign(want), sign(got)
+		}
+
+		status := ""
+		if got != want {
+			status = "  WRONG"
+			failed++
+		} else if elapsed > *limit {
+			status = "  SLOW"
+			failed++
+		}
+		fmt.Printf("%-20s %-40s %6d %6d %12d %12s%s\n", bp.Name, bp.Sequence, want, got, s.Nodes(), elapsed.Round(time.Millisecond), status)
+	}
+
+	fmt.Printf("\n%d positions, %d nodes in %s (%.0f nodes/s)\n",
+		len(positions), totalNodes, total.Round(time.Millisecond), float64(totalNodes)/total.Seconds())
+	if failed > 0 {
+		fmt.Printf("%d positions failed\n", failed)
+		os.Exit(1)
+	}
+}
+
+func loadPositions(path string) ([]benchPosition, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var positions []benchPosition
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("expected \"moves score\", got %q", scanner.Text())
+		}
+		score, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		positions = append(positions, benchPosition{
+			Name:     fmt.Sprintf("line %d", len(positions)+1),
+			Sequence: fields[0],
+			Score:    score,
+		})
+	}
+	return positions, scanner.Err()
+}
+
+func sign(x int) int {
+	switch {
+	case x > 0:
+		return 1
+	case x < 0:
+		return -1
+	}
+	return 0
+}
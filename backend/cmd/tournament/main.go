@@ -0,0 +1,330 @@
+// Command tournament plays bot configurations against each other to measure
+// whether a change is an improvement. Games run in parallel and alternate
+// which side moves first.
+//
+//	go run ./cmd/tournament -a alphabeta:hard -b mcts:hard -games 200
+//	go run ./cmd/tournament -a alphabeta:expert:depth=8 -b alphabeta:expert -movetime 200ms -log games.txt
+//	go run ./cmd/tournament -a alphabeta:hard -b mcts:hard -columns 9 -rows 7 -connect 5
+//	go run ./cmd/tournament -a alphabeta:hard -b mcts:hard -variant popout
+//	go run ./cmd/tournament -a mcts:medium -b mcts:hard -variant popten -games 20
+//
+// A configuration is engine:difficulty with optional depth=N (alpha-beta
+// only). External engines can be registered with -external, in the same
+// format as the server's EXTERNAL_ENGINES.
+package main
+
+import (
+	"bufio"
+	"connect-four/internal/bot"
+	"connect-four/internal/game"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type config struct {
+	Spec       string
+	Engine     string
+	Difficulty bot.Difficulty
+	Depth      int
+}
+
+// gameResult is the outcome of one game. Score is from A's point of view:
+// 1 for a win, 0.5 for a draw, 0 for a loss.
+type gameResult struct {
+	Index     int
+	AFirst    bool
+	Moves     []game.Action
+	Score     float64
+	Reason    string // set when a side forfeited by failing to move
+	ThinkTime [2]time.Duration
+	MoveCount [2]int
+}
+
+func main() {
+	specA := flag.String("a", "alphabeta:hard", "first configuration")
+	specB := flag.String("b", "mcts:hard", "second configuration")
+	games := flag.Int("games", 100, "number of games")
+	workers := flag.Int("workers", runtime.NumCPU(), "games played in parallel")
+	moveTime := flag.Duration("movetime", 0, "time per move, 0 for each difficulty's own budget")
+	external := flag.String("external", "", "external engines, e.g. \"ref=./refengine\"")
+	logFile := flag.String("log", "", "write every game to this file")
+	rows := flag.Int("rows", 0, "board rows, 0 for the variant's")
+	columns := flag.Int("columns", 0, "board columns, 0 for the variant's")
+	connect := flag.Int("connect", 0, "discs in a row needed to win, 0 for the variant's")
+	variantName := flag.String("variant", game.VariantStandard, "rules to play by: "+strings.Join(game.Variants(), ", "))
+	flag.Parse()
+
+	variant, err := game.ParseVariant(*variantName)
+	if err != nil {
+		log.Fatalf("Invalid -variant: %v", err)
+	}
+	size, err := game.ParseVariantSize(variant, *rows, *columns, *connect)
+	if err != nil {
+		log.Fatalf("Invalid board size: %v", err)
+	}
+
+	registry := bot.DefaultRegistry
+	configs, err := bot.ParseExternalSpec(*external)
+	if err != nil {
+		log.Fatalf("Invalid -external: %v", err)
+	}
+	for name, c := range configs {
+		bot.RegisterExternal(registry, name, c)
+	}
+
+	a, err := parseConfig(registry, *specA)
+	if err != nil {
+		log.Fatalf("Invalid -a: %v", err)
+	}
+	b, err := parseConfig(registry, *specB)
+	if err != nil {
+		log.Fatalf("Invalid -b: %v", err)
+	}
+
+	var gameLog io.Writer = io.Discard
+	if *logFile != "" {
+		f, err := os.Create(*logFile)
+		if err != nil {
+			log.Fatalf("Error creating log: %v", err)
+		}
+		defer f.Close()
+		w := bufio.NewWriter(f)
+		defer w.Flush()
+		gameLog = w
+		fmt.Fprintf(gameLog, "# A = %s, B = %s\n", a.Spec, b.Spec)
+	}
+
+	log.Printf("Playing %d games of %s (A) vs %s (B) on a %s board, %d workers...", *games, a.Spec, b.Spec, size, *workers)
+
+	jobs := make(chan int)
+	results := make(chan gameResult)
+	var wg sync.WaitGroup
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				results <- playGame(registry, size, variant, index, a, b, *moveTime)
+			}
+		}()
+	}
+	go func() {
+		for i := 0; i < *games; i++ {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	start := time.Now()
+	var stats tally
+	for r := range results {
+		stats.add(r)
+		writeGame(gameLog, r)
+		if stats.games%10 == 0 {
+			log.Printf("%d/%d games: %s", stats.games, *games, stats.record())
+		}
+	}
+
+	fmt.Printf("\n%s (A) vs %s (B), %d games in %s\n", a.Spec, b.Spec, stats.games, time.Since(start).Round(time.Second))
+	fmt.Printf("A: %s\n", stats.record())
+	elo, low, high := stats.elo()
+	fmt.Printf("Elo difference: %+.0f (95%% CI %+.0f to %+.0f)\n", elo, low, high)
+	fmt.Printf("Average move time: A %s, B %s\n", stats.avgMoveTime(0), stats.avgMoveTime(1))
+	if stats.forfeits > 0 {
+		fmt.Printf("Forfeits: %d (see log)\n", stats.forfeits)
+	}
+}
+
+func parseConfig(registry *bot.Registry, spec string) (config, error) {
+	parts := strings.Split(spec, ":")
+	c := config{Spec: spec, Difficulty: bot.DefaultDifficulty}
+
+	engine, err := registry.Parse(parts[0])
+	if err != nil {
+		return c, err
+	}
+	c.Engine = engine
+
+	for _, part := range parts[1:] {
+		if strings.HasPrefix(part, "depth=") {
+			depth, err := strconv.Atoi(strings.TrimPrefix(part, "depth="))
+			if err != nil || depth < 1 {
+				return c, fmt.Errorf("invalid depth %q", part)
+			}
+			if c.Engine != bot.EngineAlphaBeta {
+				return c, fmt.Errorf("depth only applies to %s", bot.EngineAlphaBeta)
+			}
+			c.Depth = depth
+			continue
+		}
+		difficulty, err := bot.ParseDifficulty(part)
+		if err != nil {
+			return c, err
+		}
+		c.Difficulty = difficulty
+	}
+	return c, nil
+}
+
+func newEngine(registry *bot.Registry, c config) (bot.Engine, error) {
+	engine, err := registry.New(c.Engine, c.Difficulty)
+	if err != nil {
+		return nil, err
+	}
+	if b, ok := engine.(*bot.Bot); ok && c.Depth > 0 {
+		b.Depth = c.Depth
+	}
+	return engine, nil
+}
+
+// playGame plays one game; A moves first in even-numbered games. A side whose
+// engine fails to produce a legal move loses.
+func playGame(registry *bot.Registry, size game.Size, variant string, index int, a, b config, moveTime time.Duration) gameResult {
+	r := gameResult{Index: index, AFirst: index%2 == 0}
+
+	engines := [2]bot.Engine{}
+	for side, c := range [2]config{a, b} {
+		engine, err := newEngine(registry, c)
+		if err != nil {
+			log.Fatalf("Error creating %s: %v", c.Spec, err)
+		}
+		engines[side] = engine
+		if closer, ok := engine.(io.Closer); ok {
+			defer closer.Close()
+		}
+	}
+
+	g := game.NewGameWithSettings(fmt.Sprintf("tournament_%d", index), game.Player{ID: "first"}, game.Settings{Variant: variant}, size)
+	g.AddPlayer(game.Player{ID: "second"})
+	g.SetPosition(g.Board, 0)
+
+	// side returns 0 for A and 1 for B given a seat in g
+	side := func(seat int) int {
+		if (seat == 0) == r.AFirst {
+			return 0
+		}
+		return 1
+	}
+
+	for g.Status == "playing" {
+		mover := side(g.CurrentPlayer)
+		start := time.Now()
+		move, err := engines[mover].ChooseMove(context.Background(), g, bot.Clock{MoveTime: moveTime})
+		r.ThinkTime[mover] += time.Since(start)
+		r.MoveCount[mover]++
+		if err == nil {
+			_, _, err = g.Play(move)
+		}
+		if err != nil {
+			r.Reason = fmt.Sprintf("%c forfeits: %v", 'A'+mover, err)
+			r.Score = float64(mover)
+			return r
+		}
+		r.Moves = append(r.Moves, move)
+	}
+
+	switch {
+	case g.Winner == -1:
+		r.Score = 0.5
+	case side(g.Winner) == 0:
+		r.Score = 1
+	}
+	return r
+}
+
+// writeGame logs a game as its number, who moved first, the moves in move
+// notation and the result from A's point of view.
+func writeGame(w io.Writer, r gameResult) {
+	first := "B"
+	if r.AFirst {
+		first = "A"
+	}
+	var moves strings.Builder
+	for _, move := range r.Moves {
+		moves.WriteString(move.String())
+	}
+	result := map[float64]string{1: "1-0", 0.5: "1/2", 0: "0-1"}[r.Score]
+	fmt.Fprintf(w, "%d %s %s %s", r.Index, first, moves.String(), result)
+	if r.Reason != "" {
+		fmt.Fprintf(w, " # %s", r.Reason)
+	}
+	fmt.Fprintln(w)
+}
+
+type tally struct {
+	games, wins, draws, losses int
+	forfeits                   int
+	thinkTime                  [2]time.Duration
+	moveCount                  [2]int
+}
+
+func (t *tally) add(r gameResult) {
+	t.games++
+	switch r.Score {
+	case 1:
+		t.wins++
+	case 0.5:
+		t.draws++
+	default:
+		t.losses++
+	}
+	if r.Reason != "" {
+		t.forfeits++
+	}
+	for side := 0; side < 2; side++ {
+		t.thinkTime[side] += r.ThinkTime[side]
+		t.moveCount[side] += r.MoveCount[side]
+	}
+}
+
+func (t *tally) record() string {
+	return fmt.Sprintf("%d wins, %d draws, %d losses", t.wins, t.draws, t.losses)
+}
+
+// elo returns A's rating advantage over B and a 95% confidence interval,
+// using the normal approximation of the mean game score.
+func (t *tally) elo() (diff, low, high float64) {
+	n := float64(t.games)
+	if n == 0 {
+		return 0, 0, 0
+	}
+	score := (float64(t.wins) + float64(t.draws)/2) / n
+
+	variance := (float64(t.wins)*math.Pow(1-score, 2) +
+		float64(t.draws)*math.Pow(0.5-score, 2) +
+		float64(t.losses)*math.Pow(score, 2)) / n
+	margin := 1.96 * math.Sqrt(variance/n)
+
+	return eloFromScore(score), eloFromScore(score - margin), eloFromScore(score + margin)
+}
+
+// eloFromScore converts an expected score into a rating difference. Scores
+// of 0 or 1 give infinite differences.
+func eloFromScore(score float64) float64 {
+	if score <= 0 {
+		return math.Inf(-1)
+	}
+	if score >= 1 {
+		return math.Inf(1)
+	}
+	return 400 * math.Log10(score/(1-score))
+}
+
+func (t *tally) avgMoveTime(side int) time.Duration {
+	if t.moveCount[side] == 0 {
+		return 0
+	}
+	return (t.thinkTime[side] / time.Duration(t.moveCount[side])).Round(time.Microsecond)
+}
@@ -0,0 +1,177 @@
+package bot
+
+import (
+	"connect-four/internal/game"
+	"connect-four/internal/solver"
+	"context"
+	"sort"
+)
+
+// ColumnEval is the bot's opinion of one legal column, from the point of view
+// of the side to move.
+type ColumnEval struct {
+	Column   int            `json:"column"`
+	Score    int            `json:"score"`              // search score, higher is better
+	Outcome  solver.Outcome `json:"outcome,omitempty"`  // set when the result is forced
+	Distance int            `json:"distance,omitempty"` // plies until the forced result
+	Line     []int          `json:"line"`               // expected continuation, starting with Column
+}
+
+// Analysis evaluates every legal column of a position.
+type Analysis struct {
+	Columns    []ColumnEval `json:"columns"` // ordered by column
+	BestColumn int          `json:"bestColumn"`
+	BestLine   []int        `json:"bestLine"`
+	Depth      int          `json:"depth"`  // depth of the deepest completed search
+	Solved     bool         `json:"solved"` // every column has a proven outcome
+}
+
+// Analyze scores every legal column of g within the bot's difficulty level.
+// Columns where the search finds a forced result get an outcome and distance;
+// positions late enough for the solver get them for every column. Unlike
+// CalculateMove it never consults the book or adds noise.
+func (b *Bot) Analyze(ctx context.Context, g *game.Game) (*Analysis, error) {
+	p, err := checkPosition(g)
+	if err != nil {
+		return nil, err
+	}
+
+	level := b.Difficulty.Level()
+	if b.Depth > 0 {
+		level.Depth = b.Depth
+	}
+	if level.TimeBudget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, level.TimeBudget)
+		defer cancel()
+	}
+
+	pos := newPosition(g)
+	if pos.full() {
+		return nil, ErrNoMove
+	}
+
+	s := b.newSearcher(ctx)
+	var moves []rootMove
+	analysis := &Analysis{}
+	for depth := 1; depth <= level.Depth && pos.moves+depth <= pos.size.Cells(); depth++ {
+		iteration := s.scoreRoot(pos, depth)
+		if s.stopped {
+			break
+		}
+		moves = iteration
+		analysis.Depth = depth
+	}
+
+	// Not even one ply finished: report every column as unknown
+	if moves == nil {
+		for _, col := range pos.order {
+			if pos.canPlay(col) {
+				moves = append(moves, rootMove{move: col, line: []int{col}})
+			}
+		}
+	}
+
+	for _, m := range moves {
+		c := ColumnEval{Column: m.move, Score: m.score, Line: m.line}
+		// Forced results found by the search are exact too
+		if isWinScore(m.score) {
+			c.Outcome = solver.Win
+			if m.score < 0 {
+				c.Outcome = solver.Loss
+			}
+			c.Distance = WinScore - abs(m.score)
+		}
+		analysis.Columns = append(analysis.Columns, c)
+	}
+	if p != nil && p.Moves() >= solverMinMoves {
+		analysis.Solved = solveColumns(ctx, p, analysis.Columns)
+	}
+
+	// Proven results outrank search scores; ties go to the search
+	best := &analysis.Columns[0]
+	for i := range analysis.Columns {
+		c := &analysis.Columns[i]
+		if outcomeRank(c) != outcomeRank(best) {
+			if outcomeRank(c) > outcomeRank(best) {
+				best = c
+			}
+			continue
+		}
+		if c.Score > best.Score {
+			best = c
+		}
+	}
+	analysis.BestColumn = best.Column
+	analysis.BestLine = best.Line
+
+	sort.Slice(analysis.Columns, func(i, j int) bool {
+		return analysis.Columns[i].Column < analysis.Columns[j].Column
+	})
+	return analysis, nil
+}
+
+// solveColumns fills in outcomes and distances if the solver finishes before
+// ctx is done.
+func solveColumns(ctx context.Context, p *solver.Position, columns []ColumnEval) bool {
+	s := solverPool.Get().(*solver.Solver)
+	defer solverPool.Put(s)
+
+	results, ok, err := s.ScoreMovesContext(ctx, p)
+	if err != nil {
+		return false
+	}
+	for i := range columns {
+		col := columns[i].Column
+		if ok[col] {
+			columns[i].Outcome = results[col].Outcome
+			columns[i].Distance = results[col].Distance
+		}
+	}
+	return true
+}
+
+// outcomeRank orders columns by forced result: quick wins first, then
+// unknown and drawn columns, then slow losses before quick ones.
+func outcomeRank(c *ColumnEval) int {
+	switch c.Outcome {
+	case solver.Win:
+		return 100 - c.Distance
+	case solver.Loss:
+		return -100 + c.Distance
+	}
+	return 0
+}
+
+// checkPosition rejects boards that can't arise in a game: floating discs, a
+// side with too many discs, or a game that is already decided. Analysis only
+// covers drops, so PopOut games are refused. It returns the solver's view of
+// standard boards, and nil for other sizes.
+func checkPosition(g *game.Game) (*solver.Position, error) {
+	if g.Variant() != game.VariantStandard {
+		return nil, &BotError{"analysis is only available for the standard variant"}
+	}
+	pos := game.Position{Size: g.Size, Board: g.Board, Player: g.CurrentPlayer, Variant: game.VariantStandard}
+	if err := pos.Validate(); err != nil {
+		return nil, &BotError{err.Error()}
+	}
+	if pos.Over() {
+		return nil, &BotError{"position is already decided"}
+	}
+	if g.Size != game.StandardSize {
+		return nil, nil
+	}
+
+	p, err := solver.FromGame(g)
+	if err != nil {
+		return nil, &BotError{err.Error()}
+	}
+	return p, nil
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,257 @@
+package bot
+
+import (
+	"bufio"
+	"bytes"
+	"connect-four/internal/game"
+	_ "embed"
+	"encoding/binary"
+	"io"
+	"log"
+	"sort"
+	"sync"
+)
+
+// Opening book file format (all integers little-endian):
+//
+//	header:  "C4BK" | version uint8 | max ply uint8 | reserved uint16 | entry count uint32
+//	entry:   key uint64 | move count uint8 | moves (column uint8, score int16)...
+//
+// Entries are sorted by key. Keys are BookKey values, which don't depend on
+// which seat moved first, and a position is only stored once per mirror pair.
+const (
+	bookMagic   = "C4BK"
+	bookVersion = 1
+)
+
+//go:embed openings.book
+var defaultBookData []byte
+
+var (
+	defaultBook     *Book
+	defaultBookOnce sync.Once
+)
+
+// BookMove is one recommended column and the score the generator gave it.
+type BookMove struct {
+	Column int `json:"column"`
+	Score  int `json:"score"`
+}
+
+// Book maps positions to their best moves.
+type Book struct {
+	MaxPly  int
+	entries map[uint64][]BookMove
+}
+
+func NewBook(maxPly int) *Book {
+	return &Book{
+		MaxPly:  maxPly,
+		entries: make(map[uint64][]BookMove),
+	}
+}
+
+// DefaultBook returns the book embedded in the binary, or nil if it can't be
+// read.
+func DefaultBook() *Book {
+	defaultBookOnce.Do(func() {
+		book, err := LoadBook(bytes.NewReader(defaultBookData))
+		if err != nil {
+			log.Printf("Error loading embedded opening book: %v", err)
+			return
+		}
+		defaultBook = book
+	})
+	return defaultBook
+}
+
+// Len returns the number of positions in the book.
+func (bk *Book) Len() int {
+	return len(bk.entries)
+}
+
+// Add stores the moves for g's position. Positions whose mirror image is
+// already in the book are skipped. The book only covers the standard board.
+func (bk *Book) Add(g *game.Game, moves []BookMove) {
+	if g.Size != game.StandardSize {
+		return
+	}
+	board := normalizedBoard(g)
+	if _, ok := bk.entries[hashMirror(board)]; ok {
+		return
+	}
+	bk.entries[game.HashBoard(board, 0)] = moves
+}
+
+// Contains reports whether g's position (or its mirror image) is in the book.
+func (bk *Book) Contains(g *game.Game) bool {
+	_, ok := bk.Lookup(g)
+	return ok
+}
+
+// Lookup returns the book moves for g's position, translating columns if
+// the book stores the mirror image. Only standard games are in the book.
+func (bk *Book) Lookup(g *game.Game) ([]BookMove, bool) {
+	if g.Size != game.StandardSize || g.Variant() != game.VariantStandard {
+		return nil, false
+	}
+	board := normalizedBoard(g)
+	if moves, ok := bk.entries[game.HashBoard(board, 0)]; ok {
+		return moves, true
+	}
+	moves, ok := bk.entries[hashMirror(board)]
+	if !ok {
+		return nil, false
+	}
+	mirrored := make([]BookMove, len(moves))
+	for i, m := range moves {
+		mirrored[i] = BookMove{Column: g.Size.Columns - 1 - m.Column, Score: m.Score}
+	}
+	return mirrored, true
+}
+
+// BookKey returns the key a position is stored under. Discs are relabelled so
+// the side to move is always 1, which makes the key independent of whether
+// the first or second seat opened the game.
+func BookKey(g *game.Game) uint64 {
+	return game.HashBoard(normalizedBoard(g), 0)
+}
+
+func normalizedBoard(g *game.Game) [][]int {
+	board := game.CopyBoard(g.Board)
+	if g.CurrentPlayer == 1 {
+		for row := range board {
+			for col := range board[row] {
+				if board[row][col] != 0 {
+					board[row][col] = 3 - board[row][col]
+				}
+			}
+		}
+	}
+	return board
+}
+
+func hashMirror(board [][]int) uint64 {
+	mirrored := game.CopyBoard(board)
+	for row := range board {
+		for col := range board[row] {
+			mirrored[row][len(board[row])-1-col] = board[row][col]
+		}
+	}
+	return game.HashBoard(mirrored, 0)
+}
+
+// WriteTo writes the book in its binary format.
+func (bk *Book) WriteTo(w io.Writer) (int64, error) {
+	keys := make([]uint64, 0, len(bk.entries))
+	for key := range bk.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	var buf bytes.Buffer
+	buf.WriteString(bookMagic)
+	buf.WriteByte(bookVersion)
+	buf.WriteByte(byte(bk.MaxPly))
+	binary.Write(&buf, binary.LittleEndian, uint16(0))
+	binary.Write(&buf, binary.LittleEndian, uint32(len(keys)))
+
+	for _, key := range keys {
+		moves := bk.entries[key]
+		binary.Write(&buf, binary.LittleEndian, key)
+		buf.WriteByte(byte(len(moves)))
+		for _, m := range moves {
+			buf.WriteByte(byte(m.Column))
+			binary.Write(&buf, binary.LittleEndian, int16(clampScore(m.Score)))
+		}
+	}
+
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+// LoadBook reads a book written by WriteTo.
+func LoadBook(r io.Reader) (*Book, error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, err
+	}
+	if string(header[:4]) != bookMagic {
+		return nil, &BotError{"not an opening book"}
+	}
+	if header[4] != bookVersion {
+		return nil, &BotError{"unsupported opening book version"}
+	}
+
+	bk := NewBook(int(header[5]))
+	count := binary.LittleEndian.Uint32(header[8:])
+	for i := uint32(0); i < count; i++ {
+		var key uint64
+		if err := binary.Read(br, binary.LittleEndian, &key); err != nil {
+			return nil, err
+		}
+		n, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		moves := make([]BookMove, n)
+		for j := range moves {
+			col, err := br.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			var score int16
+			if err := binary.Read(br, binary.LittleEndian, &score); err != nil {
+				return nil, err
+			}
+			if col > 6 {
+				return nil, &BotError{"opening book has an invalid column"}
+			}
+			moves[j] = BookMove{Column: int(col), Score: int(score)}
+		}
+		bk.entries[key] = moves
+	}
+	return bk, nil
+}
+
+// Search scores don't fit in an int16; forced results are squashed to the
+// ends of its range, which keeps their ordering.
+func clampScore(score int) int {
+	if score > 32767 {
+		return 32767 - (WinScore - score)
+	}
+	if score < -32767 {
+		return -32767 + (WinScore + score)
+	}
+	return score
+}
+
+// bookMove picks one of the best scoring book moves for g, if any.
+func (b *Bot) bookMove(g *game.Game) (int, bool) {
+	if b.Book == nil {
+		return -1, false
+	}
+	moves, ok := b.Book.Lookup(g)
+	if !ok || len(moves) == 0 {
+		return -1, false
+	}
+
+	bestScore := moves[0].Score
+	for _, m := range moves {
+		if m.Score > bestScore {
+			bestScore = m.Score
+		}
+	}
+
+	// Vary between equally good openings
+	best := []int{}
+	for _, m := range moves {
+		if m.Score == bestScore {
+			best = append(best, m.Column)
+		}
+	}
+	return best[b.rng.Intn(len(best))], true
+}
@@ -0,0 +1,127 @@
+package bot
+
+import (
+	"bytes"
+	"connect-four/internal/game"
+	"testing"
+)
+
+func TestBookRoundTrip(t *testing.T) {
+	bk := NewBook(4)
+	entries := map[string][]BookMove{
+		"7/7/7/7/7/7 x standard":       {{Column: 3, Score: 2}},
+		"7/7/7/7/7/1x5 o standard":     {{Column: 2, Score: -1}, {Column: 1, Score: -3}},
+		"7/7/7/7/1o5/1x1x3 o standard": {{Column: 2, Score: WinScore - 5}, {Column: 0, Score: -WinScore + 9}},
+	}
+	for position, moves := range entries {
+		bk.Add(positionGame(t, position), moves)
+	}
+	// Already in the book as the mirror image of the second entry
+	bk.Add(positionGame(t, "7/7/7/7/7/5x1 o standard"), []BookMove{{Column: 0, Score: 0}})
+	if bk.Len() != len(entries) {
+		t.Fatalf("%d entries, want %d", bk.Len(), len(entries))
+	}
+
+	var buf bytes.Buffer
+	if _, err := bk.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadBook(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != bk.Len() || loaded.MaxPly != bk.MaxPly {
+		t.Errorf("read back %d entries to ply %d, want %d to ply %d", loaded.Len(), loaded.MaxPly, bk.Len(), bk.MaxPly)
+	}
+
+	for position, want := range entries {
+		moves, ok := loaded.Lookup(positionGame(t, position))
+		if !ok {
+			t.Errorf("%s: not found", position)
+			continue
+		}
+		if len(moves) != len(want) {
+			t.Errorf("%s: %v, want %v", position, moves, want)
+			continue
+		}
+		for i := range moves {
+			// Forced results are squashed into 16 bits
+			if moves[i].Column != want[i].Column || moves[i].Score != clampScore(want[i].Score) {
+				t.Errorf("%s: %v, want %v", position, moves, want)
+			}
+		}
+	}
+
+	// The mirror image finds the same moves with mirrored columns
+	moves, ok := loaded.Lookup(positionGame(t, "7/7/7/7/5o1/3x1x1 o standard"))
+	if !ok || len(moves) != 2 || moves[0].Column != 4 || moves[1].Column != 6 {
+		t.Errorf("mirror image: %v, %t, want columns 5 and 7", moves, ok)
+	}
+
+	// Positions are the same whichever seat opened the game
+	g := positionGame(t, "7/7/7/7/7/1x5 o standard")
+	g.SetPosition(game.CopyBoard(g.Board), 0)
+	for row := range g.Board {
+		for col, disc := range g.Board[row] {
+			if disc != 0 {
+				g.Board[row][col] = 3 - disc
+			}
+		}
+	}
+	if moves, ok := loaded.Lookup(g); !ok || moves[0].Column != 2 {
+		t.Errorf("with the seats swapped: %v, %t", moves, ok)
+	}
+
+	if loaded.Contains(positionGame(t, "7/7/7/7/7/3x3 o standard")) {
+		t.Error("found a position that was never added")
+	}
+	if loaded.Contains(positionGame(t, "7/7/7/7/7/7 x popout")) {
+		t.Error("found a PopOut position")
+	}
+}
+
+func TestLoadBookRejectsBadData(t *testing.T) {
+	bk := NewBook(2)
+	bk.Add(positionGame(t, "7/7/7/7/7/7 x standard"), []BookMove{{Column: 3, Score: 1}})
+	var buf bytes.Buffer
+	bk.WriteTo(&buf)
+	good := buf.Bytes()
+
+	corrupt := func(offset int, b byte) []byte {
+		data := append([]byte(nil), good...)
+		data[offset] = b
+		return data
+	}
+	for name, data := range map[string][]byte{
+		"bad magic":      corrupt(3, 'X'),
+		"bad version":    corrupt(4, bookVersion+1),
+		"invalid column": corrupt(21, 7),
+		"truncated":      good[:len(good)-1],
+		"no header":      good[:6],
+	} {
+		if _, err := LoadBook(bytes.NewReader(data)); err == nil {
+			t.Errorf("%s: loaded", name)
+		}
+	}
+}
+
+func TestDefaultBook(t *testing.T) {
+	bk := DefaultBook()
+	if bk == nil || bk.Len() == 0 {
+		t.Fatal("embedded book is missing or empty")
+	}
+	if !bk.Contains(positionGame(t, "7/7/7/7/7/7 x standard")) {
+		t.Error("embedded book doesn't cover the empty board")
+	}
+}
+
+// Forced results stay ahead of, or behind, every evaluation once squashed
+func TestClampScoreKeepsOrder(t *testing.T) {
+	scores := []int{-WinScore + 1, -WinScore + 40, -1000, -5, 0, 5, 1000, WinScore - 40, WinScore - 1}
+	for i := 1; i < len(scores); i++ {
+		a, b := clampScore(scores[i-1]), clampScore(scores[i])
+		if a >= b || a < -32767 || b > 32767 {
+			t.Errorf("%d and %d squashed to %d and %d", scores[i-1], scores[i], a, b)
+		}
+	}
+}
@@ -2,229 +2,201 @@ package bot
 
 import (
 	"connect-four/internal/game"
+	"connect-four/internal/solver"
+	"context"
 	"math/rand"
+	"sync"
 	"time"
 )
 
+// Below this many discs a full solve can take minutes on a laptop CPU
+const solverMinMoves = 12
+
+// Solvers are expensive to allocate (their transposition table is ~40MB) and
+// their cached results stay valid for any position, so they are reused.
+var solverPool = sync.Pool{
+	New: func() interface{} {
+		return solver.NewSolver()
+	},
+}
+
 type Bot struct {
-	Difficulty int
+	Difficulty Difficulty
+	Book       *Book // consulted before searching, nil to always search
+	Depth      int   // overrides the difficulty's search depth when > 0
+	rng        *rand.Rand
+	table      *TranspositionTable
 }
 
 func NewBot() *Bot {
-	// Initialize random seed
-	rand.Seed(time.Now().UnixNano())
-	return &Bot{
-		Difficulty: 2, // Medium difficulty
-	}
+	return NewBotWithDifficulty(DefaultDifficulty)
 }
 
-func (b *Bot) CalculateMove(g *game.Game) int {
-	// Strategy: 
-	// 1. Check if bot can win immediately
-	// 2. Check if need to block opponent
-	// 3. Create winning opportunities
-	// 4. Prefer center columns
-
-	botPlayer := 2 // Assuming bot is always player 2
-	humanPlayer := 1
-
-	// Check for immediate win
-	for col := 0; col < 7; col++ {
-		if b.isValidMove(g, col) {
-			row := b.getNextAvailableRow(g, col)
-			if row != -1 {
-				// Simulate move
-				g.Board[row][col] = botPlayer
-				if g.CheckWin(row, col) {
-					g.Board[row][col] = 0 // Reset
-					return col
-				}
-				g.Board[row][col] = 0 // Reset
-			}
-		}
+func NewBotWithDifficulty(difficulty Difficulty) *Bot {
+	b := &Bot{
+		Difficulty: difficulty,
+		rng:        rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
-
-	// Block opponent's immediate win
-	for col := 0; col < 7; col++ {
-		if b.isValidMove(g, col) {
-			row := b.getNextAvailableRow(g, col)
-			if row != -1 {
-				// Simulate opponent move
-				g.Board[row][col] = humanPlayer
-				if g.CheckWin(row, col) {
-					g.Board[row][col] = 0 // Reset
-					return col
-				}
-				g.Board[row][col] = 0 // Reset
-			}
-		}
+	level := difficulty.Level()
+	if level.TableSize > 0 {
+		b.table = NewTranspositionTable(level.TableSize)
 	}
-
-	// Create opportunities (3 in a row with potential for 4)
-	priorityMoves := []int{}
-	for col := 0; col < 7; col++ {
-		if b.isValidMove(g, col) {
-			row := b.getNextAvailableRow(g, col)
-			if row != -1 {
-				g.Board[row][col] = botPlayer
-				if b.hasPotentialWin(g, botPlayer, 3) {
-					priorityMoves = append(priorityMoves, col)
-				}
-				g.Board[row][col] = 0
-			}
-		}
+	if level.UseBook {
+		b.Book = DefaultBook()
 	}
+	return b
+}
 
-	if len(priorityMoves) > 0 {
-		return priorityMoves[rand.Intn(len(priorityMoves))]
+// TableStats returns the bot's transposition table counters, or zero values
+// if its difficulty doesn't use a table.
+func (b *Bot) TableStats() TTStats {
+	if b.table == nil {
+		return TTStats{}
 	}
+	return b.table.Stats()
+}
 
-	// Create opportunities (2 in a row with potential for 4)
-	secondaryMoves := []int{}
-	for col := 0; col < 7; col++ {
-		if b.isValidMove(g, col) {
-			row := b.getNextAvailableRow(g, col)
-			if row != -1 {
-				g.Board[row][col] = botPlayer
-				if b.hasPotentialWin(g, botPlayer, 2) {
-					secondaryMoves = append(secondaryMoves, col)
-				}
-				g.Board[row][col] = 0
-			}
+// CalculateMove picks the bot's move in g. The move's Column is -1 if there
+// is no legal move.
+func (b *Bot) CalculateMove(g *game.Game) game.Action {
+	return b.CalculateMoveContext(context.Background(), g)
+}
+
+// CalculateMoveContext is CalculateMove with a deadline: when ctx is done the
+// bot stops thinking and plays the best move it has found so far.
+func (b *Bot) CalculateMoveContext(ctx context.Context, g *game.Game) game.Action {
+	// The search works on its own copy of the board, so the live game is never
+	// modified while the bot is thinking.
+	level := b.Difficulty.Level()
+	if b.Depth > 0 {
+		level.Depth = b.Depth
+	}
+	if level.TimeBudget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, level.TimeBudget)
+		defer cancel()
+	}
+
+	// Weaker tiers occasionally throw away the position on purpose
+	if level.BlunderRate > 0 && b.rng.Float64() < level.BlunderRate {
+		if a, ok := b.randomMove(g); ok {
+			return a
 		}
 	}
 
-	if len(secondaryMoves) > 0 {
-		return secondaryMoves[rand.Intn(len(secondaryMoves))]
+	// Alpha-beta needs a position; other rules get the tier's playouts
+	if !usesPosition(g) {
+		m := NewMCTSWithDifficulty(b.Difficulty, b.rng.Int63())
+		m.TimeBudget = 0 // ctx already holds the level's budget
+		return m.searchRules(ctx, g)
 	}
 
-	// Prefer center columns for better positioning
-	centerPref := []int{3, 2, 4, 1, 5, 0, 6}
-	for _, col := range centerPref {
-		if b.isValidMove(g, col) {
-			return col
-		}
+	if col, ok := b.bookMove(g); ok {
+		return game.Drop(col)
 	}
 
-	// Fallback: random valid move (should always find one if board isn't full)
-	validMoves := []int{}
-	for col := 0; col < 7; col++ {
-		if b.isValidMove(g, col) {
-			validMoves = append(validMoves, col)
+	if b.Difficulty == Perfect {
+		if col, ok := b.solveMove(ctx, g); ok {
+			return game.Drop(col)
 		}
 	}
 
-	if len(validMoves) > 0 {
-		return validMoves[rand.Intn(len(validMoves))]
-	}
-
-	return -1 // Should never reach here if board isn't full
+	result := b.SearchContext(ctx, g, level)
+	return result.Move
 }
 
-func (b *Bot) isValidMove(g *game.Game, column int) bool {
-	if column < 0 || column >= 7 {
-		return false
+// solveMove plays the proven best move once the board is full enough for the
+// solver to finish quickly. Earlier positions fall back to the normal search.
+// If the solver runs out of time, the search gets the rest of the budget.
+func (b *Bot) solveMove(ctx context.Context, g *game.Game) (int, bool) {
+	p, err := solver.FromGame(g)
+	if err != nil || p.Moves() < solverMinMoves {
+		return -1, false
 	}
-	return g.Board[0][column] == 0
-}
 
-func (b *Bot) getNextAvailableRow(g *game.Game, column int) int {
-	for row := 5; row >= 0; row-- {
-		if g.Board[row][column] == 0 {
-			return row
-		}
-	}
-	return -1
-}
+	s := solverPool.Get().(*solver.Solver)
+	defer solverPool.Put(s)
 
-func (b *Bot) hasPotentialWin(g *game.Game, player int, minSequence int) bool {
-	// Check for sequences that could lead to wins
-	for row := 0; row < 6; row++ {
-		for col := 0; col < 7; col++ {
-			if g.Board[row][col] == player || g.Board[row][col] == 0 {
-				// Check horizontal potential
-				if b.checkDirectionPotential(g, player, row, col, 0, 1) >= minSequence {
-					return true
-				}
-				// Check vertical potential
-				if b.checkDirectionPotential(g, player, row, col, 1, 0) >= minSequence {
-					return true
-				}
-				// Check diagonal potentials
-				if b.checkDirectionPotential(g, player, row, col, 1, 1) >= minSequence {
-					return true
-				}
-				if b.checkDirectionPotential(g, player, row, col, 1, -1) >= minSequence {
-					return true
-				}
-			}
-		}
+	// Leave at least half of the remaining time for the fallback search
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Until(deadline)/2)
+		defer cancel()
 	}
-	return false
+
+	col, _, err := s.BestMoveContext(ctx, p)
+	return col, err == nil && col != -1
 }
 
-func (b *Bot) checkDirectionPotential(g *game.Game, player, startRow, startCol, rowDelta, colDelta int) int {
-	count := 0
-	consecutive := true
-	
-	for i := 0; i < 4; i++ {
-		row := startRow + i*rowDelta
-		col := startCol + i*colDelta
-		
-		if row < 0 || row >= 6 || col < 0 || col >= 7 {
-			break
-		}
-		
-		// Count if it's our piece or empty (potential)
-		if g.Board[row][col] == player {
-			count++
-		} else if g.Board[row][col] == 0 && consecutive {
-			// Only count empty spaces if we haven't broken the sequence
-			count++
-		} else {
-			// Opponent piece or broken sequence
-			consecutive = false
-			break
-		}
+func (b *Bot) randomMove(g *game.Game) (game.Action, bool) {
+	validMoves := g.LegalActions()
+	if len(validMoves) == 0 {
+		return game.Action{}, false
 	}
-	return count
+	return validMoves[b.rng.Intn(len(validMoves))], true
 }
 
-// Additional helper function for better strategy
-func (b *Bot) evaluatePosition(g *game.Game, player int) int {
+// windowDirections are the steps along a row, a column and both diagonals
+var windowDirections = [4][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}}
+
+// evaluatePosition scores a board from the point of view of player by looking
+// at every window of Connect cells the player could still complete. On a
+// cylinder, windows wrap around from the last column to the first.
+func (b *Bot) evaluatePosition(p *position, player int) int {
 	score := 0
-	
+	size := p.size
+
 	// Center column preference
-	for row := 0; row < 6; row++ {
-		if g.Board[row][3] == player {
+	for row := 0; row < size.Rows; row++ {
+		if p.board[row][p.order[0]] == player {
 			score += 3
 		}
 	}
-	
-	// Horizontal opportunities
-	for row := 0; row < 6; row++ {
-		for col := 0; col < 4; col++ {
-			window := [4]int{
-				g.Board[row][col],
-				g.Board[row][col+1],
-				g.Board[row][col+2],
-				g.Board[row][col+3],
+
+	// Horizontal, vertical and diagonal opportunities
+	var cells [game.MaxConnect]int
+	window := cells[:size.Connect]
+	last := size.Connect - 1
+	for _, d := range windowDirections {
+		// A window longer than a wrapped row would hold some cells twice
+		if p.wrap && d[0] == 0 && size.Connect > size.Columns {
+			continue
+		}
+		for row := 0; row < size.Rows; row++ {
+			endRow := row + last*d[0]
+			if endRow >= size.Rows {
+				break
+			}
+			for col := 0; col < size.Columns; col++ {
+				endCol := col + last*d[1]
+				switch {
+				case p.wrap:
+					for i := range window {
+						window[i] = p.board[row+i*d[0]][(col+i*d[1]+2*size.Columns)%size.Columns]
+					}
+				case endCol < 0 || endCol >= size.Columns:
+					continue
+				default:
+					for i := range window {
+						window[i] = p.board[row+i*d[0]][col+i*d[1]]
+					}
+				}
+				score += b.evaluateWindow(window, player)
 			}
-			score += b.evaluateWindow(window, player)
 		}
 	}
-	
+
 	return score
 }
 
-func (b *Bot) evaluateWindow(window [4]int, player int) int {
+func (b *Bot) evaluateWindow(window []int, player int) int {
 	score := 0
 	opponent := 3 - player // Since players are 1 and 2
-	
+
 	playerCount := 0
 	opponentCount := 0
 	emptyCount := 0
-	
+
 	for _, cell := range window {
 		if cell == player {
 			playerCount++
@@ -234,19 +206,20 @@ func (b *Bot) evaluateWindow(window [4]int, player int) int {
 			emptyCount++
 		}
 	}
-	
+
 	// Score based on the window configuration
-	if playerCount == 4 {
+	n := len(window)
+	if playerCount == n {
 		score += 100
-	} else if playerCount == 3 && emptyCount == 1 {
+	} else if playerCount == n-1 && emptyCount == 1 {
 		score += 5
-	} else if playerCount == 2 && emptyCount == 2 {
+	} else if playerCount == n-2 && emptyCount == 2 {
 		score += 2
 	}
-	
-	if opponentCount == 3 && emptyCount == 1 {
+
+	if opponentCount == n-1 && emptyCount == 1 {
 		score -= 4 // Block opponent
 	}
-	
+
 	return score
-}
\ No newline at end of file
+}
@@ -0,0 +1,88 @@
+package bot
+
+import (
+	"strings"
+	"time"
+)
+
+// Difficulty names a bot strength tier. The value is what gets stored on the
+// bot's game.Player and in the database, so it must stay stable.
+type Difficulty string
+
+const (
+	Beginner Difficulty = "beginner"
+	Easy     Difficulty = "easy"
+	Medium   Difficulty = "medium"
+	Hard     Difficulty = "hard"
+	Expert   Difficulty = "expert"
+	Perfect  Difficulty = "perfect"
+
+	DefaultDifficulty = Medium
+)
+
+// Level holds the search parameters behind a difficulty tier.
+type Level struct {
+	Depth       int           // maximum search depth in plies
+	TimeBudget  time.Duration // no new iteration is started once this is spent
+	Noise       int           // random score jitter added to each root move
+	BlunderRate float64       // chance of playing a random legal move instead
+	TableSize   int           // transposition table entries, 0 disables the table
+	UseBook     bool          // play from the opening book when possible
+	Playouts    int           // MCTS playouts per move, 0 for time-limited only
+	Rating      int           // rough Elo strength, for picking a bot to match a player
+}
+
+var levels = map[Difficulty]Level{
+	Beginner: {Depth: 1, TimeBudget: 100 * time.Millisecond, Noise: 60, BlunderRate: 0.30, Playouts: 200, Rating: 800},
+	Easy:     {Depth: 2, TimeBudget: 200 * time.Millisecond, Noise: 30, BlunderRate: 0.15, Playouts: 1000, Rating: 1000},
+	Medium:   {Depth: 5, TimeBudget: 500 * time.Millisecond, Noise: 8, BlunderRate: 0.05, TableSize: 1 << 12, UseBook: true, Playouts: 5000, Rating: 1300},
+	Hard:     {Depth: 7, TimeBudget: 1 * time.Second, TableSize: 1 << 16, UseBook: true, Playouts: 20000, Rating: 1600},
+	Expert:   {Depth: 10, TimeBudget: 2 * time.Second, TableSize: 1 << 20, UseBook: true, Playouts: 100000, Rating: 1900},
+	Perfect:  {Depth: 42, TimeBudget: 5 * time.Second, TableSize: 1 << 20, UseBook: true, Rating: 2200},
+}
+
+// Difficulties lists every tier from weakest to strongest.
+var Difficulties = []Difficulty{Beginner, Easy, Medium, Hard, Expert, Perfect}
+
+// ParseDifficulty converts a user supplied name into a Difficulty. An empty
+// string selects DefaultDifficulty.
+func ParseDifficulty(name string) (Difficulty, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return DefaultDifficulty, nil
+	}
+	d := Difficulty(name)
+	if _, ok := levels[d]; !ok {
+		return "", &BotError{"unknown difficulty: " + name}
+	}
+	return d, nil
+}
+
+// ForRating picks the tier whose strength is closest to a player's rating.
+func ForRating(rating int) Difficulty {
+	best := DefaultDifficulty
+	for _, d := range Difficulties {
+		if abs(levels[d].Rating-rating) < abs(levels[best].Rating-rating) {
+			best = d
+		}
+	}
+	return best
+}
+
+// Level returns the search parameters for d, falling back to the default tier
+// for unknown values.
+func (d Difficulty) Level() Level {
+	if level, ok := levels[d]; ok {
+		return level
+	}
+	return levels[DefaultDifficulty]
+}
+
+// Simple error type for bot package
+type BotError struct {
+	Message string
+}
+
+func (e *BotError) Error() string {
+	return e.Message
+}
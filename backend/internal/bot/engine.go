@@ -0,0 +1,177 @@
+package bot
+
+import (
+	"connect-four/internal/game"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Clock is the time an engine may spend on one move.
+type Clock struct {
+	MoveTime  time.Duration // budget for this move, 0 to use the engine's own
+	Remaining time.Duration // time left on the bot's game clock, 0 if untimed
+	Increment time.Duration // time added to the game clock after each move
+}
+
+// Engine picks a move for the side to move in g. Implementations must not
+// modify g and should return promptly once ctx is done. An engine instance
+// is used for a single game and may keep state between moves, but is never
+// asked for two moves at once.
+type Engine interface {
+	ChooseMove(ctx context.Context, g *game.Game, clock Clock) (game.Action, error)
+}
+
+// EngineFunc adapts a plain function to the Engine interface.
+type EngineFunc func(ctx context.Context, g *game.Game, clock Clock) (game.Action, error)
+
+func (f EngineFunc) ChooseMove(ctx context.Context, g *game.Game, clock Clock) (game.Action, error) {
+	return f(ctx, g, clock)
+}
+
+// ErrNoMove is returned by engines asked to move when there is no legal
+// move.
+var ErrNoMove = &BotError{"no legal move"}
+
+// Built-in engine names, as stored in game.Settings
+const (
+	EngineAlphaBeta = "alphabeta"
+	EngineMCTS      = "mcts"
+
+	DefaultEngine = EngineAlphaBeta
+)
+
+// Factory creates a new engine instance playing at the given difficulty.
+type Factory func(difficulty Difficulty) (Engine, error)
+
+// Registry maps engine names to factories.
+type Registry struct {
+	mu        sync.RWMutex
+	factories map[string]Factory
+}
+
+func NewRegistry() *Registry {
+	return &Registry{factories: make(map[string]Factory)}
+}
+
+// DefaultRegistry holds the built-in engines.
+var DefaultRegistry = NewRegistry()
+
+func init() {
+	DefaultRegistry.Register(EngineAlphaBeta, func(difficulty Difficulty) (Engine, error) {
+		return NewBotWithDifficulty(difficulty), nil
+	})
+	DefaultRegistry.Register(EngineMCTS, func(difficulty Difficulty) (Engine, error) {
+		return NewMCTSWithDifficulty(difficulty, time.Now().UnixNano()), nil
+	})
+}
+
+// Register adds or replaces an engine. Names are case-insensitive.
+func (r *Registry) Register(name string, factory Factory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.factories[strings.ToLower(name)] = factory
+}
+
+// Has reports whether name is registered.
+func (r *Registry) Has(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.factories[strings.ToLower(name)]
+	return ok
+}
+
+// Names lists the registered engines in alphabetical order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New creates the named engine. An empty name selects DefaultEngine.
+func (r *Registry) New(name string, difficulty Difficulty) (Engine, error) {
+	if name == "" {
+		name = DefaultEngine
+	}
+	r.mu.RLock()
+	factory, ok := r.factories[strings.ToLower(name)]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, &BotError{"unknown engine: " + name}
+	}
+	return factory(difficulty)
+}
+
+// Parse validates a user supplied engine name. An empty string selects
+// DefaultEngine.
+func (r *Registry) Parse(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return DefaultEngine, nil
+	}
+	if !r.Has(name) {
+		return "", &BotError{"unknown engine: " + name}
+	}
+	return name, nil
+}
+
+// Scripted drops discs in a fixed list of columns, one per call, which makes
+// bot behaviour predictable in tests. It fails once the script runs out or a
+// scripted column is not playable.
+type Scripted struct {
+	Moves []int
+	next  int
+}
+
+func NewScripted(moves ...int) *Scripted {
+	return &Scripted{Moves: moves}
+}
+
+func (s *Scripted) ChooseMove(ctx context.Context, g *game.Game, clock Clock) (game.Action, error) {
+	if s.next >= len(s.Moves) {
+		return game.Action{}, &BotError{"script exhausted"}
+	}
+	move := game.Drop(s.Moves[s.next])
+	s.next++
+	for _, legal := range g.LegalActions() {
+		if legal == move {
+			return move, nil
+		}
+	}
+	return game.Action{}, &BotError{"scripted column is not playable"}
+}
+
+// withMoveTime applies clock.MoveTime to ctx.
+func withMoveTime(ctx context.Context, clock Clock) (context.Context, context.CancelFunc) {
+	if clock.MoveTime > 0 {
+		return context.WithTimeout(ctx, clock.MoveTime)
+	}
+	return context.WithCancel(ctx)
+}
+
+// ChooseMove implements Engine for the alpha-beta bot.
+func (b *Bot) ChooseMove(ctx context.Context, g *game.Game, clock Clock) (game.Action, error) {
+	ctx, cancel := withMoveTime(ctx, clock)
+	defer cancel()
+	if a := b.CalculateMoveContext(ctx, g); a.Column != -1 {
+		return a, nil
+	}
+	return game.Action{}, ErrNoMove
+}
+
+// ChooseMove implements Engine for MCTS.
+func (m *MCTS) ChooseMove(ctx context.Context, g *game.Game, clock Clock) (game.Action, error) {
+	ctx, cancel := withMoveTime(ctx, clock)
+	defer cancel()
+	if a := m.CalculateMoveContext(ctx, g); a.Column != -1 {
+		return a, nil
+	}
+	return game.Action{}, ErrNoMove
+}
@@ -0,0 +1,354 @@
+package bot
+
+import (
+	"bufio"
+	"connect-four/internal/game"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ExternalConfig describes an engine program speaking the line protocol
+// documented in protocol.go.
+type ExternalConfig struct {
+	Path         string
+	Args         []string
+	StartTimeout time.Duration // limit for the handshake, default 5s
+	MoveOverhead time.Duration // grace after movetime before "stop", default 500ms
+	MaxRestarts  int           // restarts allowed after the process dies, default 3
+}
+
+// External plays through a separate engine process. The process is started
+// on the first move and restarted if it dies, up to MaxRestarts times. Call
+// Close when the game is over.
+type External struct {
+	Config     ExternalConfig
+	Difficulty Difficulty
+	Name       string // as announced by the engine with "id name"
+
+	mu      sync.Mutex
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	lines   chan string
+	quit    chan struct{}
+	exited  chan struct{}
+	starts  int
+	newGame bool
+	closed  bool
+}
+
+func NewExternal(config ExternalConfig, difficulty Difficulty) *External {
+	if config.StartTimeout == 0 {
+		config.StartTimeout = 5 * time.Second
+	}
+	if config.MoveOverhead == 0 {
+		config.MoveOverhead = 500 * time.Millisecond
+	}
+	if config.MaxRestarts == 0 {
+		config.MaxRestarts = 3
+	}
+	return &External{Config: config, Difficulty: difficulty}
+}
+
+// RegisterExternal makes the engine program available under name. Every game
+// gets its own process.
+func RegisterExternal(r *Registry, name string, config ExternalConfig) {
+	r.Register(name, func(difficulty Difficulty) (Engine, error) {
+		return NewExternal(config, difficulty), nil
+	})
+}
+
+// ParseExternalSpec parses a list of engine programs written as
+// "name=command args;name2=command2", e.g. "ref=./refengine -engine mcts".
+func ParseExternalSpec(spec string) (map[string]ExternalConfig, error) {
+	configs := make(map[string]ExternalConfig)
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, &BotError{"invalid engine entry: " + entry}
+		}
+		name := strings.TrimSpace(parts[0])
+		command := strings.Fields(parts[1])
+		if name == "" || len(command) == 0 {
+			return nil, &BotError{"invalid engine entry: " + entry}
+		}
+		configs[name] = ExternalConfig{Path: command[0], Args: command[1:]}
+	}
+	return configs, nil
+}
+
+// ChooseMove implements Engine. If the engine doesn't answer within the move
+// time plus MoveOverhead it is told to stop, and killed if it still doesn't
+// answer.
+func (e *External) ChooseMove(ctx context.Context, g *game.Game, clock Clock) (game.Action, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.ensureRunning(); err != nil {
+		return game.Action{}, err
+	}
+
+	moveTime := clock.MoveTime
+	if moveTime <= 0 {
+		moveTime = e.Difficulty.Level().TimeBudget
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < moveTime {
+		moveTime = time.Until(deadline)
+	}
+	if moveTime < time.Millisecond {
+		moveTime = time.Millisecond
+	}
+
+	command := fmt.Sprintf("go movetime %d", moveTime.Milliseconds())
+	if clock.Remaining > 0 {
+		command += fmt.Sprintf(" wtime %d winc %d", clock.Remaining.Milliseconds(), clock.Increment.Milliseconds())
+	}
+
+	if e.newGame {
+		if err := e.send("newgame"); err != nil {
+			return game.Action{}, err
+		}
+		e.newGame = false
+	}
+	if err := e.send("position " + EncodePosition(g)); err != nil {
+		return game.Action{}, err
+	}
+	if err := e.send(command); err != nil {
+		return game.Action{}, err
+	}
+
+	timer := time.NewTimer(moveTime + e.Config.MoveOverhead)
+	defer timer.Stop()
+	for {
+		select {
+		case line, ok := <-e.lines:
+			if !ok {
+				e.kill()
+				return game.Action{}, &BotError{"engine exited while thinking"}
+			}
+			if a, ok, err := parseBestMove(line); ok {
+				if err != nil {
+					return game.Action{}, err
+				}
+				return validateExternalMove(g, a)
+			}
+		case <-ctx.Done():
+			// Keep the engine in sync so it can be asked for the next move
+			e.stopSearch()
+			return game.Action{}, ctx.Err()
+		case <-timer.C:
+			a, err := e.stopSearch()
+			if err != nil {
+				return game.Action{}, err
+			}
+			return validateExternalMove(g, a)
+		}
+	}
+}
+
+// Close asks the engine to quit and kills it if it doesn't.
+func (e *External) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.closed = true
+	if e.cmd == nil {
+		return nil
+	}
+	e.send("quit")
+	e.stdin.Close()
+	select {
+	case <-e.exited:
+	case <-time.After(time.Second):
+	}
+	e.kill()
+	return nil
+}
+
+// ensureRunning starts the engine process if it isn't running.
+func (e *External) ensureRunning() error {
+	if e.closed {
+		return &BotError{"engine is closed"}
+	}
+	if e.cmd != nil {
+		select {
+		case <-e.exited:
+			log.Printf("Engine %s exited, restarting", e.Config.Path)
+			e.kill()
+		default:
+			return nil
+		}
+	}
+	if e.starts > e.Config.MaxRestarts {
+		return &BotError{"engine keeps crashing: " + e.Config.Path}
+	}
+	e.starts++
+	return e.start()
+}
+
+func (e *External) start() error {
+	cmd := exec.Command(e.Config.Path, e.Config.Args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return &BotError{"starting engine: " + err.Error()}
+	}
+
+	e.cmd = cmd
+	e.stdin = stdin
+	e.lines = make(chan string, 16)
+	e.quit = make(chan struct{})
+	e.exited = make(chan struct{})
+	e.newGame = true
+
+	go func(lines chan<- string, quit <-chan struct{}, exited chan<- struct{}) {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			select {
+			case lines <- strings.TrimSpace(scanner.Text()):
+			case <-quit:
+			}
+		}
+		close(lines)
+		cmd.Wait()
+		close(exited)
+	}(e.lines, e.quit, e.exited)
+
+	go func(path string) {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			log.Printf("Engine %s: %s", path, scanner.Text())
+		}
+	}(e.Config.Path)
+
+	if err := e.handshake(); err != nil {
+		e.kill()
+		return err
+	}
+	return nil
+}
+
+func (e *External) handshake() error {
+	deadline := time.After(e.Config.StartTimeout)
+	if err := e.send(protocolHello); err != nil {
+		return err
+	}
+	if err := e.expect(protocolHelloOK, deadline); err != nil {
+		return err
+	}
+	if err := e.send("option difficulty " + string(e.Difficulty)); err != nil {
+		return err
+	}
+	if err := e.send("isready"); err != nil {
+		return err
+	}
+	return e.expect("readyok", deadline)
+}
+
+// expect reads lines until want, remembering the engine's name on the way.
+func (e *External) expect(want string, deadline <-chan time.Time) error {
+	for {
+		select {
+		case line, ok := <-e.lines:
+			if !ok {
+				return &BotError{"engine exited during handshake"}
+			}
+			if line == want {
+				return nil
+			}
+			if strings.HasPrefix(line, "id name ") {
+				e.Name = strings.TrimPrefix(line, "id name ")
+			}
+		case <-deadline:
+			return &BotError{"engine did not answer " + want + " in time"}
+		}
+	}
+}
+
+// stopSearch tells the engine to stop and waits for its bestmove. The engine
+// is killed if it doesn't answer within MoveOverhead.
+func (e *External) stopSearch() (game.Action, error) {
+	if err := e.send("stop"); err != nil {
+		return game.Action{}, err
+	}
+	timeout := time.After(e.Config.MoveOverhead)
+	for {
+		select {
+		case line, ok := <-e.lines:
+			if !ok {
+				e.kill()
+				return game.Action{}, &BotError{"engine exited while thinking"}
+			}
+			if a, ok, err := parseBestMove(line); ok {
+				return a, err
+			}
+		case <-timeout:
+			e.kill()
+			return game.Action{}, &BotError{"engine did not stop in time"}
+		}
+	}
+}
+
+func (e *External) send(line string) error {
+	if _, err := io.WriteString(e.stdin, line+"\n"); err != nil {
+		e.kill()
+		return &BotError{"writing to engine: " + err.Error()}
+	}
+	return nil
+}
+
+// kill stops the process and forgets it so the next move starts a new one.
+func (e *External) kill() {
+	if e.cmd == nil {
+		return
+	}
+	close(e.quit)
+	e.cmd.Process.Kill()
+	e.stdin.Close()
+	e.cmd = nil
+}
+
+// parseBestMove reports whether line is a bestmove answer and returns its
+// move with a 0-based column.
+func parseBestMove(line string) (game.Action, bool, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != "bestmove" {
+		return game.Action{}, false, nil
+	}
+	if len(fields) != 2 {
+		return game.Action{}, true, &BotError{"malformed bestmove: " + line}
+	}
+	a, err := DecodeMove(fields[1])
+	if err != nil {
+		return game.Action{}, true, &BotError{"malformed bestmove: " + line}
+	}
+	return a, true, nil
+}
+
+func validateExternalMove(g *game.Game, a game.Action) (game.Action, error) {
+	for _, legal := range g.LegalActions() {
+		if a == legal {
+			return a, nil
+		}
+	}
+	return game.Action{}, &BotError{"engine played illegal move " + EncodeMove(a)}
+}
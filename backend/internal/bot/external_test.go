@@ -0,0 +1,81 @@
+package bot
+
+import (
+	"connect-four/internal/game"
+	"context"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// buildRefEngine builds cmd/refengine, the reference engine speaking the
+// external protocol, and returns its path
+func buildRefEngine(t *testing.T) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("builds and runs an engine program")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+	path := filepath.Join(t.TempDir(), "refengine")
+	cmd := exec.Command(goTool, "build", "-o", path, "connect-four/cmd/refengine")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("building refengine: %v\n%s", err, out)
+	}
+	return path
+}
+
+// TestExternalRefEngine plays whole games between two refengine processes,
+// one per seat, and checks every move they send is legal.
+func TestExternalRefEngine(t *testing.T) {
+	path := buildRefEngine(t)
+
+	for _, variant := range game.Variants() {
+		t.Run(variant, func(t *testing.T) {
+			size, err := game.ParseVariantSize(variant, 0, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g := game.NewGameWithSettings("ext_"+variant, game.Player{ID: "a"}, game.Settings{Variant: variant}, size)
+			g.AddPlayer(game.Player{ID: "b"})
+
+			engines := [2]*External{
+				NewExternal(ExternalConfig{Path: path}, Easy),
+				NewExternal(ExternalConfig{Path: path, Args: []string{"-engine", EngineMCTS}}, Easy),
+			}
+			for _, e := range engines {
+				defer e.Close()
+			}
+
+			// PopOut games can go on for a long time; a legal stretch of one
+			// is enough
+			for moves := 0; g.Status == "playing" && moves < 120; moves++ {
+				seat := g.CurrentPlayer
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				a, err := engines[seat].ChooseMove(ctx, g.Clone(), Clock{MoveTime: 20 * time.Millisecond})
+				cancel()
+				if err != nil {
+					t.Fatalf("move %d: seat %d: %v", moves+1, seat, err)
+				}
+				if _, _, err := g.Play(a); err != nil {
+					t.Fatalf("move %d: seat %d sent %s: %v", moves+1, seat, a, err)
+				}
+			}
+			if len(g.Moves) == 0 {
+				t.Fatal("no moves were played")
+			}
+			t.Logf("%s after %d moves", g.Status, len(g.Moves))
+			for i, e := range engines {
+				if e.Name == "" {
+					t.Errorf("engine in seat %d didn't announce its name", i)
+				}
+			}
+			if err := g.Verify(); err != nil {
+				t.Errorf("game doesn't match its history: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package bot
+
+import (
+	"connect-four/internal/game"
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// MCTS is a Monte Carlo Tree Search bot using UCT selection. It plays a more
+// "human" game than the alpha-beta Bot: it favours moves that win often in
+// random continuations rather than ones that are provably safe.
+//
+// Given the same seed and a fixed Iterations count (and no deadline), MCTS
+// always picks the same move, which makes it usable in tests.
+type MCTS struct {
+	Iterations        int           // playouts per move, 0 for no limit
+	TimeBudget        time.Duration // stop after this long, 0 for no limit
+	Exploration       float64       // UCT exploration constant
+	HeuristicPlayouts bool          // take wins and block losses during playouts
+	rng               *rand.Rand
+}
+
+func NewMCTS(seed int64) *MCTS {
+	return &MCTS{
+		Iterations:        10000,
+		Exploration:       math.Sqrt2,
+		HeuristicPlayouts: true,
+		rng:               rand.New(rand.NewSource(seed)),
+	}
+}
+
+// NewMCTSWithDifficulty scales the number of playouts and the time budget
+// with the difficulty tier.
+func NewMCTSWithDifficulty(difficulty Difficulty, seed int64) *MCTS {
+	level := difficulty.Level()
+	m := NewMCTS(seed)
+	m.Iterations = level.Playouts
+	m.TimeBudget = level.TimeBudget
+	m.HeuristicPlayouts = difficulty != Beginner
+	return m
+}
+
+type mctsNode struct {
+	parent   *mctsNode
+	children []*mctsNode
+	untried  []int
+	move     int // move played to reach this node, numbered as in position
+	player   int // disc value of the player who played move
+	visits   int
+	wins     float64 // from player's point of view, draws count half
+	terminal bool
+	winner   int // disc value of the winner when terminal, 0 for a draw
+}
+
+func newMCTSNode(parent *mctsNode, p *position, move, player int) *mctsNode {
+	n := &mctsNode{parent: parent, move: move, player: player}
+	for _, move := range p.order {
+		if p.canPlay(move) {
+			n.untried = append(n.untried, move)
+		}
+	}
+	return n
+}
+
+// CalculateMove picks a move in g. The move's Column is -1 if there is no
+// legal move.
+func (m *MCTS) CalculateMove(g *game.Game) game.Action {
+	return m.CalculateMoveContext(context.Background(), g)
+}
+
+// CalculateMoveContext runs playouts until the iteration limit, the time
+// budget or ctx ends the search, then plays the most visited move.
+func (m *MCTS) CalculateMoveContext(ctx context.Context, g *game.Game) game.Action {
+	if m.TimeBudget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.TimeBudget)
+		defer cancel()
+	}
+	if !usesPosition(g) {
+		return m.searchRules(ctx, g)
+	}
+
+	rootPos := newPosition(g)
+	root := newMCTSNode(nil, rootPos, -1, 3-rootPos.player)
+	if len(root.untried) == 0 {
+		return game.Action{Column: -1}
+	}
+
+	var p position
+	for i := 0; m.Iterations == 0 || i < m.Iterations; i++ {
+		if i&63 == 0 && ctx.Err() != nil {
+			break
+		}
+
+		p.copyFrom(rootPos)
+		node := root
+
+		// Selection
+		for len(node.untried) == 0 && len(node.children) > 0 {
+			node = m.selectChild(node)
+			p.play(node.move)
+		}
+
+		// Expansion
+		if !node.terminal && len(node.untried) > 0 {
+			idx := m.rng.Intn(len(node.untried))
+			move := node.untried[idx]
+			node.untried = append(node.untried[:idx], node.untried[idx+1:]...)
+
+			mover := p.player
+			winner := p.play(move)
+			child := newMCTSNode(node, &p, move, mover)
+			if winner != 0 {
+				child.terminal = true
+				child.winner = winner
+				child.untried = nil
+			} else if !p.canMove() {
+				child.terminal = true
+				child.untried = nil
+			}
+			node.children = append(node.children, child)
+			node = child
+		}
+
+		// Simulation
+		winner := node.winner
+		if !node.terminal {
+			winner = m.playout(&p)
+		}
+
+		// Backpropagation
+		for n := node; n != nil; n = n.parent {
+			n.visits++
+			if winner == n.player {
+				n.wins++
+			} else if winner == 0 {
+				n.wins += 0.5
+			}
+		}
+	}
+
+	// The search may have been cancelled before it expanded anything
+	if len(root.children) == 0 {
+		return rootPos.action(root.untried[0])
+	}
+	// An immediate win is always played, however few visits it got
+	best := root.children[0]
+	for _, child := range root.children {
+		if child.terminal && child.winner == child.player {
+			return rootPos.action(child.move)
+		}
+		if child.visits > best.visits {
+			best = child
+		}
+	}
+	return rootPos.action(best.move)
+}
+
+func (m *MCTS) selectChild(node *mctsNode) *mctsNode {
+	logVisits := math.Log(float64(node.visits))
+	var best *mctsNode
+	bestValue := math.Inf(-1)
+	for _, child := range node.children {
+		value := child.wins/float64(child.visits) +
+			m.Exploration*math.Sqrt(logVisits/float64(child.visits))
+		if value > bestValue {
+			best = child
+			bestValue = value
+		}
+	}
+	return best
+}
+
+// playout finishes the game from p and returns the winner's disc value, or 0
+// for a draw. p is modified. PopOut games can go on forever, so a playout
+// that outlasts playoutLimit moves per cell counts as a draw.
+func (m *MCTS) playout(p *position) int {
+	for plies := 0; p.canMove() && plies < playoutLimit*p.size.Cells(); plies++ {
+		if winner := p.play(m.playoutMove(p)); winner != 0 {
+			return winner
+		}
+	}
+	return 0
+}
+
+const playoutLimit = 4
+
+func (m *MCTS) playoutMove(p *position) int {
+	var moves [2 * game.MaxColumns]int
+	n := 0
+	for _, move := range p.order {
+		if p.canPlay(move) {
+			moves[n] = move
+			n++
+		}
+	}
+
+	if m.HeuristicPlayouts {
+		// Win if possible, otherwise block the opponent's immediate win
+		for _, player := range [2]int{p.player, 3 - p.player} {
+			for _, move := range moves[:n] {
+				if move < p.size.Columns && p.wouldWin(move, player) {
+					return move
+				}
+			}
+		}
+	}
+	return moves[m.rng.Intn(n)]
+}
+
+// wouldWin reports whether player dropping a disc in col completes a line.
+func (p *position) wouldWin(col, player int) bool {
+	row := p.size.Rows - 1 - p.heights[col]
+	p.board[row][col] = player
+	win := p.isWin(row, col)
+	p.board[row][col] = 0
+	return win
+}
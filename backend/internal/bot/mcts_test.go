@@ -0,0 +1,44 @@
+package bot
+
+import (
+	"connect-four/internal/game"
+	"testing"
+)
+
+// positionGame starts a game from a position in position notation
+func positionGame(t *testing.T, position string) *game.Game {
+	t.Helper()
+	p, err := game.ParsePosition(position)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := game.NewGameFromPosition("test", game.Player{ID: "a"}, p)
+	g.AddPlayer(game.Player{ID: "b"})
+	return g
+}
+
+func TestMCTSDeterministic(t *testing.T) {
+	for _, position := range []string{
+		"7/7/7/7/7/7 x standard",
+		"7/7/7/7/3o3/2xx3 o standard",
+		"7/7/7/2o4/2xo3/1xxoo2 x popout",
+		"9/9/9/9/9/9/9 x standard 5",
+		"xoxoxox/oxoxoxo/xoxoxox/oxoxoxo/oxoxoxo/xxxxooo x popten",
+	} {
+		g := positionGame(t, position)
+		a, b := NewMCTS(42), NewMCTS(42)
+		a.Iterations, b.Iterations = 500, 500
+
+		// Play a few moves in lockstep; the engines must agree every time
+		for ply := 0; ply < 4 && g.Status == "playing"; ply++ {
+			moveA := a.CalculateMove(g.Clone())
+			moveB := b.CalculateMove(g.Clone())
+			if moveA != moveB {
+				t.Fatalf("%s, ply %d: same seed played %s and %s", position, ply+1, moveA, moveB)
+			}
+			if _, _, err := g.Play(moveA); err != nil {
+				t.Fatalf("%s, ply %d: %s: %v", position, ply+1, moveA, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package bot
+
+import (
+	"connect-four/internal/game"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// External engines talk to the server over stdin/stdout, one command per
+// line, in the spirit of UCI. Columns are 1-based.
+//
+// Server to engine:
+//
+//	c4ep                           start of session, engine answers "c4epok"
+//	option <name> <value>          e.g. "option difficulty hard"; may be ignored
+//	isready                        engine answers "readyok" when idle
+//	newgame                        forget everything about the previous game
+//	position <board> <side> [<connect> [<variant> [<kept>]]]
+//	                               board rows top to bottom, "/"-separated,
+//	                               "." empty, "1"/"2" discs; side is 1 or 2;
+//	                               connect is the winning line length, 4 if
+//	                               left out; variant is "standard" if left out;
+//	                               kept is the discs each player has kept in
+//	                               Pop Ten, e.g. "3-2", none if left out
+//	go movetime <ms> [wtime <ms>] [winc <ms>]
+//	                               search, then answer "bestmove <move>"
+//	stop                           answer "bestmove" as soon as possible
+//	quit                           exit
+//
+// Engine to server:
+//
+//	id name <name>                 optional, during the c4ep handshake
+//	c4epok                         end of handshake
+//	readyok
+//	info <anything>                optional progress, logged by the server
+//	bestmove <move>                a column, or in PopOut "p" and a column
+//	                               to pop it, e.g. "p4"
+const (
+	protocolHello   = "c4ep"
+	protocolHelloOK = "c4epok"
+)
+
+// EncodePosition formats g's board and side to move for a position command.
+func EncodePosition(g *game.Game) string {
+	var sb strings.Builder
+	for row := 0; row < g.Size.Rows; row++ {
+		if row > 0 {
+			sb.WriteByte('/')
+		}
+		for col := 0; col < g.Size.Columns; col++ {
+			switch g.Board[row][col] {
+			case 1:
+				sb.WriteByte('1')
+			case 2:
+				sb.WriteByte('2')
+			default:
+				sb.WriteByte('.')
+			}
+		}
+	}
+	sb.WriteByte(' ')
+	sb.WriteString(strconv.Itoa(g.CurrentPlayer + 1))
+	variant := g.Variant()
+	if g.Size.Connect != game.StandardSize.Connect || variant != game.VariantStandard {
+		sb.WriteByte(' ')
+		sb.WriteString(strconv.Itoa(g.Size.Connect))
+	}
+	if variant != game.VariantStandard {
+		sb.WriteByte(' ')
+		sb.WriteString(variant)
+	}
+	if g.Captured != [2]int{} {
+		fmt.Fprintf(&sb, " %d-%d", g.Captured[0], g.Captured[1])
+	}
+	return sb.String()
+}
+
+// EncodeMove formats a for a bestmove answer
+func EncodeMove(a game.Action) string {
+	return a.String()
+}
+
+// DecodeMove parses the move of a bestmove answer
+func DecodeMove(s string) (game.Action, error) {
+	kind := game.KindDrop
+	if strings.HasPrefix(s, "p") {
+		kind = game.KindPop
+		s = s[1:]
+	}
+	col, err := strconv.Atoi(s)
+	if err != nil {
+		return game.Action{}, &BotError{"invalid move: " + s}
+	}
+	return game.Action{Kind: kind, Column: col - 1}, nil
+}
+
+// DecodePosition parses the arguments of a position command into a game in
+// progress.
+func DecodePosition(args []string) (*game.Game, error) {
+	if len(args) < 2 || len(args) > 5 {
+		return nil, &BotError{"position needs a board and a side to move"}
+	}
+
+	rows := strings.Split(args[0], "/")
+	size := game.Size{Rows: len(rows), Columns: len(rows[0]), Connect: game.StandardSize.Connect}
+	if len(args) >= 3 {
+		connect, err := strconv.Atoi(args[2])
+		if err != nil {
+			return nil, &BotError{"connect length must be a number"}
+		}
+		size.Connect = connect
+	}
+	if err := size.Validate(); err != nil {
+		return nil, &BotError{err.Error()}
+	}
+
+	board := game.NewBoard(size)
+	for row, line := range rows {
+		if len(line) != size.Columns {
+			return nil, &BotError{"board rows must all have the same length"}
+		}
+		for col := 0; col < size.Columns; col++ {
+			switch line[col] {
+			case '1':
+				board[row][col] = 1
+			case '2':
+				board[row][col] = 2
+			case '.':
+			default:
+				return nil, &BotError{"invalid board cell: " + string(line[col])}
+			}
+		}
+	}
+
+	var player int
+	switch args[1] {
+	case "1":
+		player = 0
+	case "2":
+		player = 1
+	default:
+		return nil, &BotError{"side to move must be 1 or 2"}
+	}
+
+	variant := game.VariantStandard
+	if len(args) >= 4 {
+		v, err := game.ParseVariant(args[3])
+		if err != nil {
+			return nil, &BotError{err.Error()}
+		}
+		variant = v
+	}
+	var captured [2]int
+	if len(args) == 5 {
+		if _, err := fmt.Sscanf(args[4], "%d-%d", &captured[0], &captured[1]); err != nil {
+			return nil, &BotError{"kept discs must be two counts like 3-2"}
+		}
+	}
+
+	g := game.NewGameWithSize("external", game.Player{ID: "player1"}, size)
+	g.Settings.Variant = variant
+	g.AddPlayer(game.Player{ID: "player2"})
+	g.SetPosition(board, player)
+	g.Captured = captured
+	g.Start.Captured = captured
+	return g, nil
+}
@@ -0,0 +1,115 @@
+package bot
+
+import (
+	"connect-four/internal/game"
+	"context"
+	"math"
+)
+
+// The searches above run on position, which models the Connect Four family
+// of rules (game.ConnectRules). Other variants, such as Pop Ten, are played
+// by a plain UCT search that drives the game's own Rules: every iteration
+// replays moves on a clone of the game. It is far slower than the position
+// based searches but needs nothing from a variant beyond its Rules.
+
+// usesPosition reports whether g can be searched on a position
+func usesPosition(g *game.Game) bool {
+	_, ok := g.Rules().(*game.ConnectRules)
+	return ok
+}
+
+type rulesNode struct {
+	parent   *rulesNode
+	children []*rulesNode
+	untried  []game.Action
+	move     game.Action // move played to reach this node
+	player   int         // index of the player who played move
+	visits   int
+	wins     float64 // from player's point of view, draws count half
+}
+
+func newRulesNode(parent *rulesNode, g *game.Game, move game.Action, player int) *rulesNode {
+	return &rulesNode{parent: parent, untried: g.LegalActions(), move: move, player: player}
+}
+
+// searchRules is CalculateMoveContext for games played by any Rules
+func (m *MCTS) searchRules(ctx context.Context, g *game.Game) game.Action {
+	root := newRulesNode(nil, g, game.Action{Column: -1}, 1-g.CurrentPlayer)
+	if len(root.untried) == 0 {
+		return game.Action{Column: -1}
+	}
+
+	for i := 0; m.Iterations == 0 || i < m.Iterations; i++ {
+		if i&15 == 0 && ctx.Err() != nil {
+			break
+		}
+
+		sim := g.Clone()
+		node := root
+
+		// Selection
+		for len(node.untried) == 0 && len(node.children) > 0 {
+			node = m.selectRulesChild(node)
+			sim.Play(node.move)
+		}
+
+		// Expansion
+		if len(node.untried) > 0 {
+			idx := m.rng.Intn(len(node.untried))
+			move := node.untried[idx]
+			node.untried = append(node.untried[:idx], node.untried[idx+1:]...)
+
+			mover := sim.CurrentPlayer
+			sim.Play(move)
+			child := newRulesNode(node, sim, move, mover)
+			node.children = append(node.children, child)
+			node = child
+		}
+
+		// Simulation, with the same cap on its length as playout
+		for plies := 0; sim.Status == "playing" && plies < playoutLimit*sim.Size.Cells(); plies++ {
+			actions := sim.LegalActions()
+			sim.Play(actions[m.rng.Intn(len(actions))])
+		}
+		winner := -1
+		if sim.Status == "finished" {
+			winner = sim.Winner
+		}
+
+		// Backpropagation
+		for n := node; n != nil; n = n.parent {
+			n.visits++
+			if winner == n.player {
+				n.wins++
+			} else if winner == -1 {
+				n.wins += 0.5
+			}
+		}
+	}
+
+	if len(root.children) == 0 {
+		return root.untried[0]
+	}
+	best := root.children[0]
+	for _, child := range root.children {
+		if child.visits > best.visits {
+			best = child
+		}
+	}
+	return best.move
+}
+
+func (m *MCTS) selectRulesChild(node *rulesNode) *rulesNode {
+	logVisits := math.Log(float64(node.visits))
+	var best *rulesNode
+	bestValue := math.Inf(-1)
+	for _, child := range node.children {
+		value := child.wins/float64(child.visits) +
+			m.Exploration*math.Sqrt(logVisits/float64(child.visits))
+		if value > bestValue {
+			best = child
+			bestValue = value
+		}
+	}
+	return best
+}
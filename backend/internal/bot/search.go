@@ -0,0 +1,605 @@
+package bot
+
+import (
+	"connect-four/internal/game"
+	"context"
+	"sort"
+)
+
+const (
+	defaultSearchDepth = 7
+
+	// WinScore is returned for a won position; the ply is subtracted so that
+	// faster wins (and slower losses) are preferred.
+	WinScore = 1000000
+	infinity = WinScore + 1
+)
+
+// Center-first move ordering: central columns take part in more lines, so
+// trying them first produces far more alpha-beta cutoffs. Indexed by the
+// number of columns.
+var columnOrders [game.MaxColumns + 1][]int
+
+// popOutOrders are columnOrders followed by the pops, also center-first. See
+// position for how moves are numbered.
+var popOutOrders [game.MaxColumns + 1][]int
+
+func init() {
+	for columns := game.MinColumns; columns <= game.MaxColumns; columns++ {
+		order := make([]int, columns)
+		for col := range order {
+			order[col] = col
+		}
+		// Twice the distance from the middle keeps it whole on even boards;
+		// ties go to the left: 3, 2, 4, 1, 5, 0, 6 for seven columns
+		sort.SliceStable(order, func(i, j int) bool {
+			return abs(2*order[i]-(columns-1)) < abs(2*order[j]-(columns-1))
+		})
+		columnOrders[columns] = order
+
+		popOutOrders[columns] = append([]int(nil), order...)
+		for _, col := range order {
+			popOutOrders[columns] = append(popOutOrders[columns], columns+col)
+		}
+	}
+}
+
+// SearchResult is the outcome of a search from the side to move.
+type SearchResult struct {
+	Move  game.Action   `json:"move"` // Column is -1 when there is no legal move
+	Score int           `json:"score"`
+	PV    []game.Action `json:"pv"` // principal variation, starting with Move
+	Depth int           `json:"depth"`
+	Nodes int64         `json:"nodes"`
+}
+
+// position is the bot's private copy of a game board. Searching on it keeps
+// the *game.Game handed to the bot untouched. It models game.ConnectRules
+// only; see usesPosition.
+//
+// Moves are numbered: a drop is its column, and in PopOut a pop is the number
+// of columns plus its column.
+type position struct {
+	size    game.Size
+	board   [][]int
+	heights []int // discs already in each column
+	order   []int // moves, center-first
+	popOut  bool
+	wrap    bool   // lines wrap around from the last column to the first
+	player  int    // disc value (1 or 2) of the side to move
+	moves   int    // discs on the board
+	hash    uint64 // Zobrist hash, see game.HashBoard, mixed with layoutKey
+}
+
+func newPosition(g *game.Game) *position {
+	var pops, wrap bool
+	if r, ok := g.Rules().(*game.ConnectRules); ok {
+		pops, wrap = r.Pops, r.Wrap
+	}
+	p := &position{
+		size:    g.Size,
+		board:   game.CopyBoard(g.Board),
+		heights: make([]int, g.Size.Columns),
+		order:   columnOrders[g.Size.Columns],
+		popOut:  pops,
+		wrap:    wrap,
+		player:  g.CurrentPlayer + 1,
+		hash:    g.ComputeHash() ^ layoutKey(g.Size, pops, wrap),
+	}
+	if p.popOut {
+		p.order = popOutOrders[g.Size.Columns]
+	}
+	for col := 0; col < p.size.Columns; col++ {
+		for row := p.size.Rows - 1; row >= 0 && p.board[row][col] != 0; row-- {
+			p.heights[col]++
+			p.moves++
+		}
+	}
+	return p
+}
+
+// layoutKey tells apart the board sizes and rules a bot may search in turn.
+// Zobrist keys only name a cell by its row and column, so without it the
+// same discs on boards of different sizes, or under different rules, would
+// share a transposition table entry; every empty board would hash to 0.
+func layoutKey(size game.Size, popOut, wrap bool) uint64 {
+	x := uint64(size.Rows)<<16 | uint64(size.Columns)<<8 | uint64(size.Connect)
+	if popOut {
+		x |= 1 << 24
+	}
+	if wrap {
+		x |= 1 << 25
+	}
+	// splitmix64 finalizer, to spread the few bits over the whole key
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+// copyFrom makes p a copy of other, reusing p's memory where it can.
+func (p *position) copyFrom(other *position) {
+	if p.size != other.size {
+		p.board = game.NewBoard(other.size)
+		p.heights = make([]int, other.size.Columns)
+	}
+	for row := range other.board {
+		copy(p.board[row], other.board[row])
+	}
+	copy(p.heights, other.heights)
+	p.size, p.order, p.popOut, p.wrap = other.size, other.order, other.popOut, other.wrap
+	p.player, p.moves, p.hash = other.player, other.moves, other.hash
+}
+
+// full reports whether every cell holds a disc
+func (p *position) full() bool {
+	return p.moves == p.size.Cells()
+}
+
+// canMove reports whether the side to move has a legal move; if not the game
+// is drawn.
+func (p *position) canMove() bool {
+	if !p.full() {
+		return true
+	}
+	if p.popOut {
+		for col := 0; col < p.size.Columns; col++ {
+			if p.board[p.size.Rows-1][col] == p.player {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *position) canPlay(move int) bool {
+	if move < 0 || move >= 2*p.size.Columns {
+		return false
+	}
+	if move >= p.size.Columns {
+		return p.popOut && p.board[p.size.Rows-1][move-p.size.Columns] == p.player
+	}
+	return p.heights[move] < p.size.Rows
+}
+
+// action converts a move number into a game.Action
+func (p *position) action(move int) game.Action {
+	if move >= p.size.Columns {
+		return game.Pop(move - p.size.Columns)
+	}
+	return game.Drop(move)
+}
+
+// actions converts a line of move numbers into game.Actions
+func (p *position) actions(line []int) []game.Action {
+	actions := make([]game.Action, len(line))
+	for i, move := range line {
+		actions[i] = p.action(move)
+	}
+	return actions
+}
+
+// play makes a move for the side to move and returns the disc value of the
+// player it wins for, or 0. Only a pop can win for the opponent, and a pop
+// that completes lines for both players wins for the one who popped.
+func (p *position) play(move int) int {
+	mover := p.player
+	if move >= p.size.Columns {
+		col := move - p.size.Columns
+		p.pop(col)
+		p.player = 3 - p.player
+		p.hash ^= game.ZobristSide()
+		return p.popWinner(col, mover)
+	}
+
+	col := move
+	row := p.size.Rows - 1 - p.heights[col]
+	p.board[row][col] = p.player
+	p.hash ^= game.ZobristKey(row, col, p.player) ^ game.ZobristSide()
+	p.heights[col]++
+	p.moves++
+	p.player = 3 - p.player
+	if p.isWin(row, col) {
+		return mover
+	}
+	return 0
+}
+
+func (p *position) undo(move int) {
+	p.player = 3 - p.player
+	p.hash ^= game.ZobristSide()
+	if move >= p.size.Columns {
+		p.unpop(move - p.size.Columns)
+		return
+	}
+
+	col := move
+	p.heights[col]--
+	p.moves--
+	row := p.size.Rows - 1 - p.heights[col]
+	p.board[row][col] = 0
+	p.hash ^= game.ZobristKey(row, col, p.player)
+}
+
+// pop takes the bottom disc out of col and moves the rest down a row
+func (p *position) pop(col int) {
+	for row := p.size.Rows - 1; row >= 0; row-- {
+		disc := 0
+		if row > 0 {
+			disc = p.board[row-1][col]
+		}
+		p.setCell(row, col, disc)
+	}
+	p.heights[col]--
+	p.moves--
+}
+
+// unpop moves the discs in col up a row and puts the side to move's disc
+// back at the bottom.
+func (p *position) unpop(col int) {
+	for row := 0; row < p.size.Rows-1; row++ {
+		p.setCell(row, col, p.board[row+1][col])
+	}
+	p.setCell(p.size.Rows-1, col, p.player)
+	p.heights[col]++
+	p.moves++
+}
+
+func (p *position) setCell(row, col, disc int) {
+	if old := p.board[row][col]; old != 0 {
+		p.hash ^= game.ZobristKey(row, col, old)
+	}
+	if disc != 0 {
+		p.hash ^= game.ZobristKey(row, col, disc)
+	}
+	p.board[row][col] = disc
+}
+
+// popWinner returns who wins after mover popped col: every disc left in it
+// moved, so any new line runs through one of them.
+func (p *position) popWinner(col, mover int) int {
+	winner := 0
+	for row := p.size.Rows - p.heights[col]; row < p.size.Rows; row++ {
+		if p.isWin(row, col) {
+			if p.board[row][col] == mover {
+				return mover
+			}
+			winner = p.board[row][col]
+		}
+	}
+	return winner
+}
+
+// isWin reports whether the disc at (row, col) completes a winning line.
+func (p *position) isWin(row, col int) bool {
+	if p.wrap {
+		return p.isWrappedWin(row, col)
+	}
+	player := p.board[row][col]
+	directions := [4][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}}
+	for _, d := range directions {
+		count := 1
+		for _, sign := range [2]int{1, -1} {
+			r, c := row+sign*d[0], col+sign*d[1]
+			for r >= 0 && r < p.size.Rows && c >= 0 && c < p.size.Columns && p.board[r][c] == player {
+				count++
+				r += sign * d[0]
+				c += sign * d[1]
+			}
+		}
+		if count >= p.size.Connect {
+			return true
+		}
+	}
+	return false
+}
+
+// isWrappedWin is isWin on a cylinder, where lines continue from the last
+// column to the first. A row is a ring, so a line along it is never counted
+// past the row's length.
+func (p *position) isWrappedWin(row, col int) bool {
+	player := p.board[row][col]
+	columns := p.size.Columns
+	for _, d := range windowDirections {
+		limit := p.size.Connect
+		if d[0] == 0 && columns < limit {
+			limit = columns
+		}
+		count := 1
+		for _, sign := range [2]int{1, -1} {
+			r, c := row+sign*d[0], (col+sign*d[1]+columns)%columns
+			for count < limit && r >= 0 && r < p.size.Rows && p.board[r][c] == player {
+				count++
+				r += sign * d[0]
+				c = (c + sign*d[1] + columns) % columns
+			}
+		}
+		if count >= p.size.Connect {
+			return true
+		}
+	}
+	return false
+}
+
+// Search runs a fixed-depth negamax alpha-beta search for the side to move in g.
+func (b *Bot) Search(g *game.Game, depth int) SearchResult {
+	s := b.newSearcher(context.Background())
+	return s.search(newPosition(g), depth, 0)
+}
+
+// SearchContext deepens the search one ply at a time until the level's depth
+// is reached, a forced result is found, the level's time budget is spent or
+// ctx is done. An unfinished iteration is thrown away, so the result is always
+// the best move of the deepest completed search.
+func (b *Bot) SearchContext(ctx context.Context, g *game.Game, level Level) SearchResult {
+	if level.TimeBudget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, level.TimeBudget)
+		defer cancel()
+	}
+
+	p := newPosition(g)
+	s := b.newSearcher(ctx)
+
+	result := SearchResult{Move: game.Action{Column: -1}}
+	for depth := 1; depth <= level.Depth && p.canReach(depth); depth++ {
+		iteration := s.search(p, depth, level.Noise)
+		if s.stopped {
+			break
+		}
+		result = iteration
+		if isWinScore(result.Score) {
+			break
+		}
+	}
+
+	// Out of time before even one ply finished: any legal move beats none
+	if result.Move.Column == -1 {
+		for _, move := range p.order {
+			if p.canPlay(move) {
+				result.Move = p.action(move)
+				result.PV = []game.Action{result.Move}
+				break
+			}
+		}
+	}
+	return result
+}
+
+// canReach reports whether a search depth plies deep has anything new to
+// find: without pops the board fills up.
+func (p *position) canReach(depth int) bool {
+	return p.popOut || p.moves+depth <= p.size.Cells()
+}
+
+func (s *searcher) search(p *position, depth, noise int) SearchResult {
+	var score int
+	var pv []int
+	if noise > 0 {
+		score, pv = s.noisyRoot(p, depth, noise)
+	} else {
+		score, pv = s.negamax(p, depth, -infinity, infinity, 0)
+	}
+
+	result := SearchResult{
+		Move:  game.Action{Column: -1},
+		Score: score,
+		PV:    p.actions(pv),
+		Depth: depth,
+		Nodes: s.nodes,
+	}
+	if len(pv) > 0 {
+		result.Move = result.PV[0]
+	}
+	return result
+}
+
+func isWinScore(score int) bool {
+	return score > WinScore-100 || score < -WinScore+100
+}
+
+type searcher struct {
+	bot     *Bot
+	table   *TranspositionTable // nil when the difficulty doesn't use one
+	ctx     context.Context
+	stopped bool // set once ctx is done; every score after that is garbage
+	nodes   int64
+}
+
+func (b *Bot) newSearcher(ctx context.Context) *searcher {
+	if b.table != nil {
+		b.table.NewSearch()
+	}
+	return &searcher{bot: b, table: b.table, ctx: ctx}
+}
+
+// checkStop polls the context every few thousand nodes, which keeps the cost
+// of the check negligible while still stopping within a millisecond or so.
+func (s *searcher) checkStop() bool {
+	if !s.stopped && s.nodes&1023 == 0 {
+		select {
+		case <-s.ctx.Done():
+			s.stopped = true
+		default:
+		}
+	}
+	return s.stopped
+}
+
+func (s *searcher) negamax(p *position, depth, alpha, beta, ply int) (int, []int) {
+	s.nodes++
+	if s.checkStop() {
+		return 0, nil
+	}
+
+	if !p.canMove() {
+		return 0, nil // Draw
+	}
+	if depth == 0 {
+		return s.evaluate(p), nil
+	}
+
+	alphaOrig := alpha
+	ttMove := -1
+	if s.table != nil {
+		if entry, ok := s.table.probe(p.hash); ok {
+			ttMove = int(entry.best)
+			// Never cut off at the root, it has to return a full line
+			if ply > 0 && int(entry.depth) >= depth {
+				score := scoreFromTT(int(entry.score), ply)
+				switch entry.bound {
+				case boundExact:
+					alpha, beta = score, score
+				case boundLower:
+					if score > alpha {
+						alpha = score
+					}
+				case boundUpper:
+					if score < beta {
+						beta = score
+					}
+				}
+				if alpha >= beta {
+					s.table.stats.Cutoffs++
+					if ttMove >= 0 {
+						return score, []int{ttMove}
+					}
+					return score, nil
+				}
+			}
+		}
+	}
+
+	best := -infinity
+	bestMove := -1
+	var bestLine []int
+	for _, move := range moveOrder(p, ttMove) {
+		if !p.canPlay(move) {
+			continue
+		}
+
+		mover := p.player
+		winner := p.play(move)
+		var score int
+		var line []int
+		switch winner {
+		case 0:
+			score, line = s.negamax(p, depth-1, -beta, -alpha, ply+1)
+			score = -score
+		case mover:
+			score = WinScore - ply - 1
+		default:
+			score = -(WinScore - ply - 1)
+		}
+		p.undo(move)
+		if s.stopped {
+			return 0, nil
+		}
+
+		if score > best {
+			best = score
+			bestMove = move
+			bestLine = append([]int{move}, line...)
+		}
+		if best > alpha {
+			alpha = best
+		}
+		if alpha >= beta {
+			break
+		}
+	}
+
+	if s.table != nil {
+		bound := boundExact
+		if best <= alphaOrig {
+			bound = boundUpper
+		} else if best >= beta {
+			bound = boundLower
+		}
+		s.table.store(p.hash, depth, scoreToTT(best, ply), bound, bestMove)
+	}
+	return best, bestLine
+}
+
+// moveOrder tries the transposition table's best move first, then the
+// remaining moves center-first.
+func moveOrder(p *position, first int) []int {
+	if first < 0 {
+		return p.order
+	}
+	order := make([]int, 0, len(p.order))
+	order = append(order, first)
+	for _, move := range p.order {
+		if move != first {
+			order = append(order, move)
+		}
+	}
+	return order
+}
+
+// rootMove is the score of one root move and the line expected after it.
+type rootMove struct {
+	move  int
+	score int
+	line  []int // starting with move
+}
+
+// scoreRoot scores every legal root move with a full window, center-first.
+// It returns nil if the search was stopped.
+func (s *searcher) scoreRoot(p *position, depth int) []rootMove {
+	var moves []rootMove
+	for _, move := range p.order {
+		if !p.canPlay(move) {
+			continue
+		}
+
+		mover := p.player
+		winner := p.play(move)
+		var score int
+		var line []int
+		switch winner {
+		case 0:
+			score, line = s.negamax(p, depth-1, -infinity, infinity, 1)
+			score = -score
+		case mover:
+			score = WinScore - 1
+		default:
+			score = -(WinScore - 1)
+		}
+		p.undo(move)
+		if s.stopped {
+			return nil
+		}
+		moves = append(moves, rootMove{move: move, score: score, line: append([]int{move}, line...)})
+	}
+	return moves
+}
+
+// noisyRoot jitters the score of every root move, so weaker tiers pick among
+// roughly equal moves instead of always the best. Forced wins and losses are
+// never disturbed.
+func (s *searcher) noisyRoot(p *position, depth, noise int) (int, []int) {
+	moves := s.scoreRoot(p, depth)
+	if s.stopped {
+		return 0, nil
+	}
+
+	best := -infinity
+	var bestLine []int
+	for _, m := range moves {
+		score := m.score
+		if !isWinScore(score) {
+			score += s.bot.rng.Intn(2*noise+1) - noise
+		}
+		if score > best {
+			best = score
+			bestLine = m.line
+		}
+	}
+	return best, bestLine
+}
+
+// evaluate returns the static score of p from the side to move's point of view.
+func (s *searcher) evaluate(p *position) int {
+	return s.bot.evaluatePosition(p, p.player) - s.bot.evaluatePosition(p, 3-p.player)
+}
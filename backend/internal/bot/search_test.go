@@ -0,0 +1,71 @@
+package bot
+
+import (
+	"connect-four/internal/game"
+	"testing"
+)
+
+func TestSearchTactics(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		position string
+		depth    int
+		want     game.Action
+		win      bool // the side to move has a forced win
+	}{
+		{"win in 1", "7/7/7/7/ooo4/xxx4 x standard", 1, game.Drop(3), true},
+		{"vertical win in 1", "7/7/7/o6/o5x/o4xx o standard", 1, game.Drop(0), true},
+		{"block a loss in 1", "7/7/7/7/x6/ooo1xx1 x standard", 4, game.Drop(3), false},
+		{"forced win in 3", "7/7/7/7/o6/o1xx3 x standard", 5, game.Drop(4), true},
+		{"pop to win in 1", "7/7/7/x6/oxxx3/xoxo3 x popout", 1, game.Pop(0), true},
+	} {
+		g := positionGame(t, test.position)
+		result := NewBot().Search(g, test.depth)
+		if result.Move != test.want {
+			t.Errorf("%s: played %s, want %s", test.name, result.Move, test.want)
+		}
+		if win := result.Score > WinScore-100; win != test.win {
+			t.Errorf("%s: score %d, want a forced win %t", test.name, result.Score, test.win)
+		}
+		if len(result.PV) == 0 || result.PV[0] != result.Move {
+			t.Errorf("%s: principal variation %v doesn't start with %s", test.name, result.PV, result.Move)
+		}
+	}
+}
+
+// TestSearchLeavesGameUnchanged searches a position and checks that nothing
+// about the game the bot was handed has changed.
+func TestSearchLeavesGameUnchanged(t *testing.T) {
+	for _, position := range []string{
+		"7/7/7/7/3o3/2xx3 o standard",
+		"7/7/7/2o4/2xo3/1xxoo2 x popout",
+		"9/9/9/9/9/9/9 x standard 5",
+	} {
+		g := positionGame(t, position)
+		for _, a := range []game.Action{game.Drop(3), game.Drop(4)} {
+			if _, _, err := g.Play(a); err != nil {
+				t.Fatal(err)
+			}
+		}
+		before := g.Clone()
+
+		b := NewBotWithDifficulty(Hard)
+		b.Book = nil
+		b.Search(g, 6)
+		b.CalculateMove(g)
+
+		if !game.BoardsEqual(g.Board, before.Board) {
+			t.Errorf("%s: board changed to %v", position, g.Board)
+		}
+		if g.CurrentPlayer != before.CurrentPlayer || g.Hash != before.Hash || g.Status != before.Status ||
+			g.Winner != before.Winner || g.Captured != before.Captured {
+			t.Errorf("%s: game state changed", position)
+		}
+		if len(g.Moves) != len(before.Moves) {
+			t.Errorf("%s: %d moves recorded, want %d", position, len(g.Moves), len(before.Moves))
+		}
+		if err := g.Verify(); err != nil {
+			t.Errorf("%s: %v", position, err)
+		}
+	}
+}
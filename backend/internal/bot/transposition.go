@@ -0,0 +1,129 @@
+package bot
+
+// Bound types stored with a transposition table score
+const (
+	boundExact uint8 = iota
+	boundLower       // score is at least the stored value (beta cutoff)
+	boundUpper       // score is at most the stored value (no move raised alpha)
+)
+
+type ttEntry struct {
+	key        uint64
+	score      int32
+	depth      int8
+	bound      uint8
+	best       int8 // best move found (see position), -1 if unknown
+	generation uint8
+}
+
+// TTStats reports how well the transposition table is working, to help size
+// it for each difficulty.
+type TTStats struct {
+	Size     int   `json:"size"`
+	Probes   int64 `json:"probes"`
+	Hits     int64 `json:"hits"`
+	Cutoffs  int64 `json:"cutoffs"` // hits whose bound ended the search of a node
+	Stores   int64 `json:"stores"`
+	Replaced int64 `json:"replaced"` // stores that evicted a different position
+}
+
+// HitRate returns the fraction of probes that found the position.
+func (s TTStats) HitRate() float64 {
+	if s.Probes == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Probes)
+}
+
+// TranspositionTable is a fixed-size cache of search results keyed by Zobrist
+// hash. Each bucket has two slots: the first keeps the deepest result (unless
+// it is left over from an older search), the second is always overwritten, so
+// deep results survive while recent shallow ones are still cached.
+type TranspositionTable struct {
+	buckets    [][2]ttEntry
+	mask       uint64
+	generation uint8
+	stats      TTStats
+}
+
+// NewTranspositionTable creates a table with room for at least size entries,
+// rounded up to a power of two.
+func NewTranspositionTable(size int) *TranspositionTable {
+	buckets := 1
+	for buckets*2 < size {
+		buckets <<= 1
+	}
+	return &TranspositionTable{
+		buckets: make([][2]ttEntry, buckets),
+		mask:    uint64(buckets - 1),
+		stats:   TTStats{Size: buckets * 2},
+	}
+}
+
+// NewSearch ages the existing entries so they are replaced in preference to
+// results from the coming search.
+func (t *TranspositionTable) NewSearch() {
+	t.generation++
+}
+
+func (t *TranspositionTable) probe(key uint64) (ttEntry, bool) {
+	t.stats.Probes++
+	bucket := &t.buckets[key&t.mask]
+	for i := range bucket {
+		if bucket[i].key == key && bucket[i].depth > 0 {
+			t.stats.Hits++
+			return bucket[i], true
+		}
+	}
+	return ttEntry{}, false
+}
+
+func (t *TranspositionTable) store(key uint64, depth, score int, bound uint8, best int) {
+	t.stats.Stores++
+	bucket := &t.buckets[key&t.mask]
+	entry := ttEntry{
+		key:        key,
+		score:      int32(score),
+		depth:      int8(depth),
+		bound:      bound,
+		best:       int8(best),
+		generation: t.generation,
+	}
+
+	slot := &bucket[1]
+	deep := &bucket[0]
+	if deep.key == key || deep.depth == 0 || deep.generation != t.generation || depth >= int(deep.depth) {
+		slot = deep
+	}
+	if slot.depth > 0 && slot.key != key {
+		t.stats.Replaced++
+	}
+	*slot = entry
+}
+
+// Stats returns the counters collected since the table was created.
+func (t *TranspositionTable) Stats() TTStats {
+	return t.stats
+}
+
+// Win scores depend on the distance from the root, so they are stored
+// relative to the node and converted back when read.
+func scoreToTT(score, ply int) int {
+	if score > WinScore-100 {
+		return score + ply
+	}
+	if score < -WinScore+100 {
+		return score - ply
+	}
+	return score
+}
+
+func scoreFromTT(score, ply int) int {
+	if score > WinScore-100 {
+		return score - ply
+	}
+	if score < -WinScore+100 {
+		return score + ply
+	}
+	return score
+}
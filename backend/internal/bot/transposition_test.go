@@ -0,0 +1,120 @@
+package bot
+
+import "testing"
+
+// Keys that all fall in the first bucket of a four entry table
+const (
+	keyA uint64 = 2 << iota
+	keyB
+	keyC
+	keyD
+)
+
+func TestTranspositionTableReplacement(t *testing.T) {
+	tt := NewTranspositionTable(4)
+	if size := tt.Stats().Size; size != 4 {
+		t.Fatalf("table of %d entries, want 4", size)
+	}
+
+	tt.store(keyA, 8, 10, boundExact, 3)
+	// Shallower results go to the second slot and keep the deep one
+	tt.store(keyB, 2, 20, boundLower, 4)
+	tt.store(keyC, 3, 30, boundUpper, 2)
+	if e, ok := tt.probe(keyA); !ok || e.depth != 8 || e.score != 10 || e.best != 3 {
+		t.Errorf("deep entry %+v, %t after shallower stores", e, ok)
+	}
+	if _, ok := tt.probe(keyB); ok {
+		t.Error("second slot kept an older shallow entry")
+	}
+	if e, ok := tt.probe(keyC); !ok || e.bound != boundUpper {
+		t.Errorf("latest shallow entry %+v, %t", e, ok)
+	}
+
+	// A deeper result takes the first slot
+	tt.store(keyD, 9, 40, boundExact, 1)
+	if _, ok := tt.probe(keyA); ok {
+		t.Error("deep entry survived a deeper one")
+	}
+
+	// The same position is updated in place, even by a shallower result
+	tt.store(keyD, 1, 50, boundLower, 0)
+	if e, ok := tt.probe(keyD); !ok || e.depth != 1 || e.score != 50 {
+		t.Errorf("updated entry %+v, %t", e, ok)
+	}
+
+	// Entries from an older search give way to new ones of any depth
+	tt.store(keyA, 9, 60, boundExact, 5)
+	tt.NewSearch()
+	tt.store(keyB, 1, 70, boundExact, 6)
+	if _, ok := tt.probe(keyA); ok {
+		t.Error("entry from the previous search wasn't replaced")
+	}
+	if e, ok := tt.probe(keyB); !ok || e.score != 70 {
+		t.Errorf("new search entry %+v, %t", e, ok)
+	}
+}
+
+func TestTranspositionTableStats(t *testing.T) {
+	tt := NewTranspositionTable(4)
+	if rate := tt.Stats().HitRate(); rate != 0 {
+		t.Errorf("hit rate %v before any probe", rate)
+	}
+
+	tt.store(keyA, 5, 0, boundExact, 0) // empty slot
+	tt.store(keyB, 1, 0, boundExact, 0) // empty slot
+	tt.store(keyC, 1, 0, boundExact, 0) // evicts B
+	tt.store(keyC, 2, 0, boundExact, 0) // same position
+	tt.probe(keyA)
+	tt.probe(keyB)
+	tt.probe(keyC)
+	tt.probe(keyD)
+
+	stats := tt.Stats()
+	want := TTStats{Size: 4, Probes: 4, Hits: 2, Stores: 4, Replaced: 1}
+	if stats != want {
+		t.Errorf("stats %+v, want %+v", stats, want)
+	}
+	if rate := stats.HitRate(); rate != 0.5 {
+		t.Errorf("hit rate %v, want 0.5", rate)
+	}
+}
+
+// TestSearchUsesTable checks a search of a real position probes the table
+// and finds positions it has seen, and that a repeated search does better.
+func TestSearchUsesTable(t *testing.T) {
+	b := NewBotWithDifficulty(Hard)
+	g := positionGame(t, "7/7/7/7/3o3/2xx3 o standard")
+	b.Search(g, 6)
+	first := b.TableStats()
+	if first.Probes == 0 || first.Stores == 0 || first.Hits == 0 {
+		t.Fatalf("table unused by a 6 ply search: %+v", first)
+	}
+
+	b.Search(g, 6)
+	second := b.TableStats()
+	hits, probes := second.Hits-first.Hits, second.Probes-first.Probes
+	if float64(hits)/float64(probes) <= first.HitRate() {
+		t.Errorf("repeated search hit rate %.2f, no better than the first %.2f", float64(hits)/float64(probes), first.HitRate())
+	}
+}
+
+// TestPositionHashLayout checks that one bot, and so one table, can search
+// boards of different sizes and rules without their positions colliding.
+func TestPositionHashLayout(t *testing.T) {
+	seen := make(map[uint64]string)
+	for _, position := range []string{
+		"7/7/7/7/7/7 x standard",
+		"7/7/7/7/7/7 x standard 5",
+		"8/8/8/8/8/8/8 x standard",
+		"7/7/7/7/7/7 x popout",
+		"7/7/7/7/7/7 x cylinder",
+		"7/7/7/7/7/3x3 o standard",
+		"8/8/8/8/8/8/3x4 o standard",
+	} {
+		p := newPosition(positionGame(t, position))
+		if other, ok := seen[p.hash]; ok {
+			t.Errorf("%s hashes like %s", position, other)
+		}
+		seen[p.hash] = position
+	}
+}
@@ -2,6 +2,8 @@ package database
 
 import (
 	"connect-four/internal/game"
+	"connect-four/internal/rating"
+	"connect-four/internal/review"
 	"database/sql"
 	"encoding/json"
 	"log"
@@ -47,6 +49,27 @@ func (s *PostgresStore) Init() error {
 		draws INTEGER DEFAULT 0,
 		updated_at TIMESTAMP NOT NULL
 	);
+
+	ALTER TABLE games ADD COLUMN IF NOT EXISTS bot_level VARCHAR(20);
+	ALTER TABLE games ADD COLUMN IF NOT EXISTS moves TEXT;
+	ALTER TABLE games ADD COLUMN IF NOT EXISTS variant VARCHAR(20);
+	ALTER TABLE leaderboard ADD COLUMN IF NOT EXISTS rating INTEGER NOT NULL DEFAULT 1200;
+
+	CREATE TABLE IF NOT EXISTS bot_results (
+		username VARCHAR(100) NOT NULL,
+		bot_level VARCHAR(20) NOT NULL,
+		wins INTEGER DEFAULT 0,
+		losses INTEGER DEFAULT 0,
+		draws INTEGER DEFAULT 0,
+		updated_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (username, bot_level)
+	);
+
+	CREATE TABLE IF NOT EXISTS game_reviews (
+		game_id VARCHAR(50) PRIMARY KEY,
+		review TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL
+	);
 	`
 
 	_, err := s.db.Exec(query)
@@ -55,11 +78,12 @@ func (s *PostgresStore) Init() error {
 
 func (s *PostgresStore) SaveGame(g *game.Game) error {
 	query := `
-	INSERT INTO games (id, player1, player2, winner, status, board_state, created_at, finished_at)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	INSERT INTO games (id, player1, player2, winner, status, board_state, created_at, finished_at, bot_level, moves, variant)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 	`
 
 	boardState, _ := json.Marshal(g.Board)
+	moves, _ := json.Marshal(g.Moves)
 	var winner sql.NullString
 	if g.Winner >= 0 {
 		winner.String = g.Players[g.Winner].Username
@@ -72,6 +96,12 @@ func (s *PostgresStore) SaveGame(g *game.Game) error {
 		player2.Valid = true
 	}
 
+	var botLevel sql.NullString
+	if seat := botSeat(g); seat != -1 {
+		botLevel.String = g.Players[seat].BotLevel
+		botLevel.Valid = true
+	}
+
 	finishedAt := time.Now()
 	if g.Status != "finished" {
 		finishedAt = g.CreatedAt
@@ -86,16 +116,25 @@ func (s *PostgresStore) SaveGame(g *game.Game) error {
 		string(boardState),
 		g.CreatedAt,
 		finishedAt,
+		botLevel,
+		string(moves),
+		g.Rules().Name(),
 	)
 
 	if err == nil && g.Status == "finished" {
 		s.updateLeaderboard(g)
+		s.updateBotResults(g)
 	}
 
 	return err
 }
 
 func (s *PostgresStore) updateLeaderboard(g *game.Game) {
+	// Bot matches are exhibitions
+	if g.Players[0].IsBot && g.Players[1].IsBot {
+		return
+	}
+
 	if g.Winner == -1 {
 		// Draw - update both players
 		s.updatePlayerStats(g.Players[0].Username, 0, 0, 1)
@@ -114,6 +153,71 @@ func (s *PostgresStore) updateLeaderboard(g *game.Game) {
 	}
 }
 
+// botSeat returns the index of the bot player, or -1 if there is none
+func botSeat(g *game.Game) int {
+	for i, p := range g.Players {
+		if p.IsBot {
+			return i
+		}
+	}
+	return -1
+}
+
+// botResult is a human's result in one game against a bot, counted against
+// the bot's difficulty tier so a win against a beginner bot isn't confused
+// with one against expert
+type botResult struct {
+	Username string
+	BotLevel string
+	Wins     int
+	Losses   int
+	Draws    int
+}
+
+// botResultOf returns the human's result in a game against a bot, or false
+// for games between two humans or two bots
+func botResultOf(g *game.Game) (botResult, bool) {
+	botSeat := botSeat(g)
+	if botSeat == -1 || g.Players[1-botSeat].IsBot {
+		return botResult{}, false
+	}
+
+	r := botResult{Username: g.Players[1-botSeat].Username, BotLevel: g.Players[botSeat].BotLevel}
+	switch g.Winner {
+	case -1:
+		r.Draws = 1
+	case botSeat:
+		r.Losses = 1
+	default:
+		r.Wins = 1
+	}
+	return r, true
+}
+
+// updateBotResults adds the human's result against a bot to bot_results
+func (s *PostgresStore) updateBotResults(g *game.Game) {
+	r, ok := botResultOf(g)
+	if !ok {
+		return
+	}
+
+	query := `
+	INSERT INTO bot_results (username, bot_level, wins, losses, draws, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (username, bot_level)
+	DO UPDATE SET
+		wins = bot_results.wins + EXCLUDED.wins,
+		losses = bot_results.losses + EXCLUDED.losses,
+		draws = bot_results.draws + EXCLUDED.draws,
+		updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := s.db.Exec(query, r.Username, r.BotLevel, r.Wins, r.Losses, r.Draws, time.Now())
+	if err != nil {
+		log.Printf("Error updating bot results: %v", err)
+	}
+}
+
 func (s *PostgresStore) updatePlayerStats(username string, wins, losses, draws int) {
 	query := `
 	INSERT INTO leaderboard (username, wins, losses, draws, updated_at)
@@ -134,7 +238,7 @@ func (s *PostgresStore) updatePlayerStats(username string, wins, losses, draws i
 
 func (s *PostgresStore) GetLeaderboard() ([]LeaderboardEntry, error) {
 	query := `
-	SELECT username, wins, losses, draws
+	SELECT username, wins, losses, draws, rating
 	FROM leaderboard 
 	ORDER BY wins DESC, draws DESC, losses ASC
 	LIMIT 100
@@ -146,6 +250,58 @@ func (s *PostgresStore) GetLeaderboard() ([]LeaderboardEntry, error) {
 	}
 	defer rows.Close()
 
+	var entries []LeaderboardEntry
+	for rows.Next() {
+		var entry LeaderboardEntry
+		err := rows.Scan(&entry.Username, &entry.Wins, &entry.Losses, &entry.Draws, &entry.Rating)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// GetRating returns a player's rating, or rating.ErrNotFound
+func (s *PostgresStore) GetRating(username string) (int, error) {
+	var r int
+	err := s.db.QueryRow(`SELECT rating FROM leaderboard WHERE username = $1`, username).Scan(&r)
+	if err == sql.ErrNoRows {
+		return 0, rating.ErrNotFound
+	}
+	return r, err
+}
+
+// SaveRating stores a player's rating next to their results
+func (s *PostgresStore) SaveRating(username string, r int) error {
+	query := `
+	INSERT INTO leaderboard (username, rating, updated_at)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (username)
+	DO UPDATE SET rating = EXCLUDED.rating, updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := s.db.Exec(query, username, r, time.Now())
+	return err
+}
+
+// GetBotLeaderboard ranks players by their results against one bot tier
+func (s *PostgresStore) GetBotLeaderboard(botLevel string) ([]LeaderboardEntry, error) {
+	query := `
+	SELECT username, wins, losses, draws
+	FROM bot_results
+	WHERE bot_level = $1
+	ORDER BY wins DESC, draws DESC, losses ASC
+	LIMIT 100
+	`
+
+	rows, err := s.db.Query(query, botLevel)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
 	var entries []LeaderboardEntry
 	for rows.Next() {
 		var entry LeaderboardEntry
@@ -153,15 +309,54 @@ func (s *PostgresStore) GetLeaderboard() ([]LeaderboardEntry, error) {
 		if err != nil {
 			return nil, err
 		}
+		entry.BotLevel = botLevel
 		entries = append(entries, entry)
 	}
 
 	return entries, nil
 }
 
+// SaveReview stores the annotated record of a finished game, replacing any
+// earlier review of it.
+func (s *PostgresStore) SaveReview(r *review.Review) error {
+	query := `
+	INSERT INTO game_reviews (game_id, review, created_at)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (game_id)
+	DO UPDATE SET review = EXCLUDED.review, created_at = EXCLUDED.created_at
+	`
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(query, r.GameID, string(data), r.CreatedAt)
+	return err
+}
+
+// GetReview returns a stored review, or review.ErrNotFound
+func (s *PostgresStore) GetReview(gameID string) (*review.Review, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT review FROM game_reviews WHERE game_id = $1`, gameID).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, review.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var r review.Review
+	if err := json.Unmarshal([]byte(data), &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
 type LeaderboardEntry struct {
 	Username string `json:"username"`
 	Wins     int    `json:"wins"`
 	Losses   int    `json:"losses"`
 	Draws    int    `json:"draws"`
+	Rating   int    `json:"rating,omitempty"`
+	BotLevel string `json:"botLevel,omitempty"`
 }
\ No newline at end of file
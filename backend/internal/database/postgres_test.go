@@ -0,0 +1,68 @@
+package database
+
+import (
+	"connect-four/internal/bot"
+	"connect-four/internal/game"
+	"testing"
+)
+
+// finishedGame returns a finished game between two players, either of whom
+// may be a bot of the tier given instead of a username
+func finishedGame(players [2]string, bots [2]bool, winner int) *game.Game {
+	g := game.NewGame("results", game.Player{})
+	for seat, name := range players {
+		if bots[seat] {
+			g.Players[seat] = game.Player{ID: "bot", Username: "Bot", IsBot: true, BotLevel: name}
+		} else {
+			g.Players[seat] = game.Player{ID: name, Username: name}
+		}
+	}
+	g.Status = "finished"
+	g.Winner = winner
+	return g
+}
+
+// TestBotResultsSplitByTier adds up results the way the bot_results upsert
+// does, keyed by player and tier, which is what ?botLevel= reads back.
+func TestBotResultsSplitByTier(t *testing.T) {
+	beginner, expert := string(bot.Beginner), string(bot.Expert)
+	games := []*game.Game{
+		finishedGame([2]string{"ann", beginner}, [2]bool{false, true}, 0),
+		finishedGame([2]string{beginner, "ann"}, [2]bool{true, false}, 1), // the bot moved first
+		finishedGame([2]string{"ann", expert}, [2]bool{false, true}, 1),
+		finishedGame([2]string{expert, "ann"}, [2]bool{true, false}, -1),
+		finishedGame([2]string{"bob", expert}, [2]bool{false, true}, 0),
+		finishedGame([2]string{"ann", "bob"}, [2]bool{false, false}, 0),   // no bot
+		finishedGame([2]string{beginner, expert}, [2]bool{true, true}, 1), // exhibition
+	}
+
+	type key struct{ username, level string }
+	results := make(map[key]botResult)
+	for _, g := range games {
+		r, ok := botResultOf(g)
+		if !ok {
+			continue
+		}
+		k := key{r.Username, r.BotLevel}
+		total := results[k]
+		total.Username, total.BotLevel = r.Username, r.BotLevel
+		total.Wins += r.Wins
+		total.Losses += r.Losses
+		total.Draws += r.Draws
+		results[k] = total
+	}
+
+	want := map[key]botResult{
+		{"ann", beginner}: {Username: "ann", BotLevel: beginner, Wins: 2},
+		{"ann", expert}:   {Username: "ann", BotLevel: expert, Losses: 1, Draws: 1},
+		{"bob", expert}:   {Username: "bob", BotLevel: expert, Wins: 1},
+	}
+	if len(results) != len(want) {
+		t.Errorf("results for %d player and tier pairs, want %d: %v", len(results), len(want), results)
+	}
+	for k, w := range want {
+		if got := results[k]; got != w {
+			t.Errorf("%s against %s: %+v, want %+v", k.username, k.level, got, w)
+		}
+	}
+}
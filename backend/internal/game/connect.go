@@ -0,0 +1,180 @@
+package game
+
+import "fmt"
+
+// ConnectRules are Connect Four and its close relatives: players drop discs,
+// and the first to line up Size.Connect of theirs wins.
+//
+// With Pops (PopOut) a player may instead take one of their own discs out of
+// the bottom row; the discs above it fall down one row. A pop can complete
+// lines for either player: if it completes lines for both, the player who
+// popped wins. A full board is only a draw if the player to move has nothing
+// to pop, and as pops can undo drops, a position that comes up
+// RepetitionLimit times is a draw too.
+//
+// With Wrap the board is a cylinder: the last column is followed by the
+// first, so horizontal and diagonal lines can run off one edge and continue
+// from the other.
+type ConnectRules struct {
+	Variant     string
+	Pops        bool // players may pop their own discs, as in PopOut
+	Wrap        bool // lines wrap around from the last column to the first
+	Fixed       Size // the only size allowed, zero for any
+	EdgeColumns bool // the outer columns start full of alternating discs
+}
+
+// The Connect Four variants
+var (
+	Standard = &ConnectRules{Variant: VariantStandard}
+	PopOut   = &ConnectRules{Variant: VariantPopOut, Pops: true}
+	// FiveInARow is played on a wider board whose outer columns start full,
+	// so lines can run off the middle of the board into them
+	FiveInARow = &ConnectRules{Variant: VariantFiveInARow, Fixed: Size{Rows: 6, Columns: 9, Connect: 5}, EdgeColumns: true}
+	Cylinder   = &ConnectRules{Variant: VariantCylinder, Wrap: true}
+)
+
+// RepetitionLimit is how many times the same position, with the same side to
+// move, may occur before a game with pops is drawn.
+const RepetitionLimit = 3
+
+func (r *ConnectRules) Name() string {
+	return r.Variant
+}
+
+func (r *ConnectRules) DefaultSize() Size {
+	if r.Fixed != (Size{}) {
+		return r.Fixed
+	}
+	return StandardSize
+}
+
+func (r *ConnectRules) CheckSize(size Size) error {
+	if r.Fixed != (Size{}) && size != r.Fixed {
+		return &GameError{fmt.Sprintf("%s is played on %s", r.Variant, r.Fixed)}
+	}
+	return size.Validate()
+}
+
+func (r *ConnectRules) Setup(size Size) [][]int {
+	board := NewBoard(size)
+	if r.EdgeColumns {
+		// Alternating from the bottom, the first player's disc lowest on the
+		// left and the second's on the right
+		for i := 0; i < size.Rows; i++ {
+			row := size.Rows - 1 - i
+			board[row][0] = 1 + i%2
+			board[row][size.Columns-1] = 2 - i%2
+		}
+	}
+	return board
+}
+
+func (r *ConnectRules) LegalMoves(g *Game) []Action {
+	var actions []Action
+	for col := 0; col < g.Size.Columns; col++ {
+		if g.Board[0][col] == 0 {
+			actions = append(actions, Drop(col))
+		}
+	}
+	if r.Pops {
+		for col := 0; col < g.Size.Columns; col++ {
+			if g.Board[g.Size.Rows-1][col] == g.CurrentPlayer+1 {
+				actions = append(actions, Pop(col))
+			}
+		}
+	}
+	return actions
+}
+
+func (r *ConnectRules) Apply(g *Game, a Action) (Move, error) {
+	if a.Column < 0 || a.Column >= g.Size.Columns {
+		return Move{}, &GameError{"invalid column"}
+	}
+
+	switch a.Kind {
+	case KindDrop:
+		row := g.dropRow(a.Column)
+		if row == -1 {
+			return Move{}, &GameError{"column is full"}
+		}
+		g.setCell(row, a.Column, g.CurrentPlayer+1)
+		return Move{Kind: KindDrop, Column: a.Column, Row: row}, nil
+
+	case KindPop:
+		if !r.Pops {
+			return Move{}, &GameError{"pops are not allowed in " + r.Variant + " games"}
+		}
+		row := g.Size.Rows - 1
+		if g.Board[row][a.Column] != g.CurrentPlayer+1 {
+			return Move{}, &GameError{"you can only pop your own disc"}
+		}
+		g.popColumn(a.Column)
+		return Move{Kind: KindPop, Column: a.Column, Row: row}, nil
+	}
+	return Move{}, &GameError{"unknown move kind: " + a.Kind}
+}
+
+func (r *ConnectRules) Outcome(g *Game) Outcome {
+	mover := g.CurrentPlayer
+	switch {
+	case g.hasLine(mover + 1):
+		return Outcome{Finished: true, Winner: mover}
+	case g.hasLine(2 - mover):
+		// Only a pop can hand the opponent a line
+		return Outcome{Finished: true, Winner: 1 - mover}
+	}
+
+	next := 1 - mover
+	if !r.canMove(g, next) {
+		return Outcome{Finished: true, Winner: -1}
+	}
+	if r.Pops && g.repetitions(next) >= RepetitionLimit {
+		return Outcome{Finished: true, Winner: -1}
+	}
+	return Outcome{Next: next}
+}
+
+// canMove reports whether player has a legal move on g's board
+func (r *ConnectRules) canMove(g *Game, player int) bool {
+	if !g.IsBoardFull() {
+		return true
+	}
+	if r.Pops {
+		for col := 0; col < g.Size.Columns; col++ {
+			if g.Board[g.Size.Rows-1][col] == player+1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CheckPosition checks that the disc counts fit the side to move and that
+// the side to move has no line already. Pops change the counts and can hand
+// the side to move a line, so games with pops skip both checks.
+func (r *ConnectRules) CheckPosition(p Position) error {
+	if r.Pops {
+		return nil
+	}
+	if p.Captured != [2]int{} {
+		return &GameError{"no discs are kept in " + r.Variant + " games"}
+	}
+
+	var count [3]int
+	for _, row := range p.Board {
+		for _, disc := range row {
+			count[disc]++
+		}
+	}
+	// Either side may have started, so the side to move has as many discs as
+	// the other or one fewer
+	mover, other := count[p.Player+1], count[2-p.Player]
+	if mover != other && mover+1 != other {
+		return &GameError{"disc counts don't match the side to move"}
+	}
+
+	if p.game().hasLine(p.Player + 1) {
+		return &GameError{"side to move already has a winning line"}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package game
+
+import "testing"
+
+func TestPopOutSimultaneousLines(t *testing.T) {
+	for _, test := range []struct {
+		position string
+		winner   int
+	}{
+		// Popping x's corner disc drops o's line into the bottom row and x's
+		// into the row above: both connect, and the player who popped wins
+		{"7/7/7/x6/oxxx3/xooo3 x popout", 0},
+		// Here the same pop only completes o's line
+		{"7/7/7/7/oxxx3/xooo3 x popout", 1},
+	} {
+		g := playGame(t, test.position, "p1")
+		if g.Status != "finished" || g.Winner != test.winner {
+			t.Errorf("%s: %s with winner %d, want winner %d", test.position, g.Status, g.Winner, test.winner)
+		}
+	}
+}
+
+func TestPopOutRepetition(t *testing.T) {
+	// Each round drops a disc for each player and pops them again, which
+	// brings back the empty board with x to move
+	g := playGame(t, "7/7/7/7/7/7 x popout", "12p1p2")
+	if g.Status != "playing" {
+		t.Fatalf("%s after the empty board came up twice", g.Status)
+	}
+	g = playGame(t, "7/7/7/7/7/7 x popout", "12p1p212p1p2")
+	if g.Status != "finished" || g.Winner != -1 {
+		t.Errorf("%s with winner %d after the empty board came up %d times, want a draw",
+			g.Status, g.Winner, RepetitionLimit)
+	}
+
+}
+
+// fiveInARowStart is the Five-in-a-Row board before any moves, the edge
+// columns filled alternately from x at the bottom left and o at the bottom
+// right
+const fiveInARowStart = "o7x/x7o/o7x/x7o/o7x/x7o x fiveinarow 5"
+
+func TestFiveInARowEdgeColumns(t *testing.T) {
+	size, err := ParseVariantSize(VariantFiveInARow, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Size{Rows: 6, Columns: 9, Connect: 5}); size != want {
+		t.Errorf("default size %s, want %s", size, want)
+	}
+	if _, err := ParseVariantSize(VariantFiveInARow, 6, 7, 4); err == nil {
+		t.Error("accepted a standard board")
+	}
+
+	start, err := ParsePosition(fiveInARowStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := NewGameWithSettings("test", Player{ID: "a"}, Settings{Variant: VariantFiveInARow}, size)
+	if !BoardsEqual(g.Board, start.Board) {
+		t.Errorf("new game board %v, want %v", g.Board, start.Board)
+	}
+	g.AddPlayer(Player{ID: "b"})
+	if !BoardsEqual(g.Start.Board, start.Board) {
+		t.Errorf("game started from %v, want %v", g.Start.Board, start.Board)
+	}
+	if g.Hash != g.ComputeHash() {
+		t.Error("hash leaves out the edge columns")
+	}
+
+	// x's edge disc counts towards a line along the bottom
+	g = playGame(t, fiveInARowStart, "2737475")
+	if g.Status != "finished" || g.Winner != 0 {
+		t.Errorf("%s with winner %d, want x to win with the edge disc", g.Status, g.Winner)
+	}
+}
+
+func TestCylinderWrappedLines(t *testing.T) {
+	for _, test := range []struct {
+		name, board, moves string
+	}{
+		// x's line runs from the two rightmost columns on to the first two
+		{"horizontal", "7/7/7/7/7/7 x", "6677112"},
+		// x's diagonal climbs from the bottom right through the first three
+		// columns
+		{"diagonal", "7/7/7/1xo4/xox4/ooo3x x", "3"},
+	} {
+		g := playGame(t, test.board+" "+VariantCylinder, test.moves)
+		if g.Status != "finished" || g.Winner != 0 {
+			t.Errorf("%s: %s with winner %d, want x to win around the edge", test.name, g.Status, g.Winner)
+		}
+		g = playGame(t, test.board+" "+VariantStandard, test.moves)
+		if g.Status != "playing" {
+			t.Errorf("%s: %s without the wrap", test.name, g.Status)
+		}
+	}
+}
+
+func TestCylinderRingLimit(t *testing.T) {
+	// A row of four can't make five by going round twice
+	g := playGame(t, "4/4/4/4/4 x cylinder 5", "1122334")
+	if g.Status != "playing" {
+		t.Fatalf("%s with winner %d after a full ring of four", g.Status, g.Winner)
+	}
+	// Nor can the rings of both players that fill the board
+	g = playGame(t, "4/4/4/4/4 x cylinder 5", "1122334411223344123")
+	if g.Status != "playing" {
+		t.Errorf("%s with winner %d before the board is full", g.Status, g.Winner)
+	}
+	if _, _, err := g.Play(Drop(3)); err != nil || g.Status != "finished" || g.Winner != -1 {
+		t.Errorf("full board: %v, %s with winner %d, want a draw", err, g.Status, g.Winner)
+	}
+}
@@ -7,32 +7,143 @@ import (
 )
 
 type Player struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
-	IsBot    bool   `json:"isBot"`
+	ID        string `json:"id"`
+	Username  string `json:"username"`
+	IsBot     bool   `json:"isBot"`
+	BotLevel  string `json:"botLevel,omitempty"`  // difficulty tier when IsBot
+	BotEngine string `json:"botEngine,omitempty"` // overrides Settings.BotEngine when IsBot
+}
+
+// Game modes decide which assistance is allowed
+const (
+	ModeCasual   = "casual"   // hints allowed
+	ModeTraining = "training" // hints allowed, for practising against bots
+	ModeRated    = "rated"    // no assistance
+)
+
+// Settings are chosen when a game is created
+type Settings struct {
+	BotDifficulty string `json:"botDifficulty,omitempty"` // tier used if a bot joins; one near the player's rating when empty
+	BotEngine     string `json:"botEngine,omitempty"`     // engine behind the bot, e.g. "mcts"
+	Mode          string `json:"mode,omitempty"`          // casual when empty
+	Variant       string `json:"variant,omitempty"`       // standard when empty
+	TimeControl   string `json:"timeControl,omitempty"`   // e.g. "5+3", agreed in matchmaking; no clock is kept
+}
+
+// ParseMode validates a user supplied game mode. An empty string selects
+// ModeCasual.
+func ParseMode(mode string) (string, error) {
+	switch mode {
+	case "", ModeCasual:
+		return ModeCasual, nil
+	case ModeTraining, ModeRated:
+		return mode, nil
+	}
+	return "", &GameError{"unknown game mode: " + mode}
+}
+
+// Variants
+const (
+	VariantStandard   = "standard"   // drop discs, first to connect wins
+	VariantPopOut     = "popout"     // players may also pop their own disc out of the bottom of a column
+	VariantFiveInARow = "fiveinarow" // five in a row on a 9x6 board with full edge columns
+	VariantPopTen     = "popten"     // fill the board, then pop discs out of lines to collect ten
+	VariantCylinder   = "cylinder"   // the board's left and right edges join, so lines can wrap around
+)
+
+// ParseVariant validates a user supplied variant against the registered
+// rules. An empty string selects VariantStandard.
+func ParseVariant(variant string) (string, error) {
+	r, ok := LookupRules(variant)
+	if !ok {
+		return "", &GameError{"unknown variant: " + variant}
+	}
+	return r.Name(), nil
+}
+
+func (s Settings) variant() string {
+	if s.Variant == "" {
+		return VariantStandard
+	}
+	return s.Variant
+}
+
+// HintsAllowed reports whether players may ask the bot for help.
+func (s Settings) HintsAllowed() bool {
+	return s.Mode != ModeRated
 }
 
 type Game struct {
 	ID            string    `json:"id"`
-	Board         [6][7]int `json:"board"` // 7 columns, 6 rows
+	Size          Size      `json:"size"`
+	Board         [][]int   `json:"board"` // Size.Rows rows of Size.Columns cells, top row first
 	Players       [2]Player `json:"players"`
-	CurrentPlayer int       `json:"currentPlayer"` // 0 or 1
-	Status        string    `json:"status"`        // "waiting", "playing", "finished"
-	Winner        int       `json:"winner"`        // -1: draw, 0/1: player index
+	Settings      Settings  `json:"settings"`
+	CurrentPlayer int       `json:"currentPlayer"`    // 0 or 1
+	Status        string    `json:"status"`           // "waiting", "playing", "finished"
+	Winner        int       `json:"winner"`           // -1: draw, 0/1: player index
+	Result        string    `json:"result,omitempty"` // how a finished game ended off the board, e.g. ResultForfeit
+	Captured      [2]int    `json:"captured"`         // Pop Ten: discs each player has kept
 	CreatedAt     time.Time `json:"createdAt"`
 	LastMoveAt    time.Time `json:"lastMoveAt"`
+	Start         Start     `json:"start"` // position the game began from
+	Moves         []Move    `json:"moves"` // every move since Start, oldest first
+	Hash          uint64    `json:"-"`     // Zobrist hash, kept up to date by Play
+
+	preset    bool     // Board and CurrentPlayer were set up before the game started
+	positions []uint64 // hash after each move with the next side to move, for repetitions
 }
 
+// Results of games decided off the board
+const (
+	ResultForfeit = "forfeit" // the loser left and didn't come back in time
+)
+
+// Move kinds
+const (
+	KindDrop = "drop" // a disc dropped into a column
+	KindPop  = "pop"  // one of the mover's discs taken from the bottom of a column
+)
+
+// Action is a move a player can choose: what to do and in which column
+type Action struct {
+	Kind   string `json:"kind"`
+	Column int    `json:"column"`
+}
+
+// Drop returns the action of dropping a disc into column
+func Drop(column int) Action {
+	return Action{Kind: KindDrop, Column: column}
+}
+
+// Pop returns the action of popping a disc out of the bottom of column
+func Pop(column int) Action {
+	return Action{Kind: KindPop, Column: column}
+}
+
+// Move is one entry of a game's history
 type Move struct {
-	PlayerID string `json:"playerId"`
-	Column   int    `json:"column"`
-	Row      int    `json:"row"`
+	PlayerID    string    `json:"playerId"`
+	Player      int       `json:"player"` // index of the player who moved
+	Kind        string    `json:"kind"`   // KindDrop or KindPop
+	Column      int       `json:"column"`
+	Row         int       `json:"row"`
+	Kept        bool      `json:"kept,omitempty"` // Pop Ten: the popped disc was kept
+	Timestamp   time.Time `json:"timestamp"`
+	ThinkTimeMs int64     `json:"thinkTimeMs"` // since the previous move, or the start
 }
 
 func NewGame(id string, player1 Player) *Game {
+	return NewGameWithSize(id, player1, StandardSize)
+}
+
+// NewGameWithSize creates a game on a board of the given size, which must be
+// valid.
+func NewGameWithSize(id string, player1 Player, size Size) *Game {
 	return &Game{
 		ID:        id,
-		Board:     [6][7]int{},
+		Size:      size,
+		Board:     NewBoard(size),
 		Players:   [2]Player{player1, {}},
 		Status:    "waiting",
 		Winner:    -1,
@@ -40,146 +151,155 @@ func NewGame(id string, player1 Player) *Game {
 	}
 }
 
+// NewGameWithSettings creates a game played by the rules of settings.Variant
+// on a board of the given size, set up the way the variant starts. The size
+// must suit the variant; see ParseVariantSize.
+func NewGameWithSettings(id string, player1 Player, settings Settings, size Size) *Game {
+	g := NewGameWithSize(id, player1, size)
+	g.Settings = settings
+	g.Board = g.Rules().Setup(size)
+	return g
+}
+
 func (g *Game) AddPlayer(player2 Player) {
 	g.Players[1] = player2
-	g.Status = "playing"
-	g.CurrentPlayer = rand.Intn(2) // Random starting player
+	g.start()
 }
 
-func (g *Game) AddBot() {
-	g.Players[1] = Player{
-		ID:       "bot_" + g.ID,
-		Username: "CompetitiveBot",
-		IsBot:    true,
+// AddBot seats a bot in the first empty seat, so a game created without a
+// first player can be played by two bots. The game starts once both seats
+// are taken. An empty engine leaves the choice to Settings.BotEngine.
+func (g *Game) AddBot(level, engine string) int {
+	seat := 1
+	id := "bot_" + g.ID
+	if g.Players[0].ID == "" {
+		seat = 0
+		id = "bot0_" + g.ID
+	}
+	g.Players[seat] = Player{
+		ID:        id,
+		Username:  "CompetitiveBot",
+		IsBot:     true,
+		BotLevel:  level,
+		BotEngine: engine,
+	}
+	if g.Players[0].ID != "" && g.Players[1].ID != "" {
+		g.start()
 	}
+	return seat
+}
+
+func (g *Game) start() {
 	g.Status = "playing"
-	g.CurrentPlayer = rand.Intn(2)
+	if !g.preset {
+		g.CurrentPlayer = rand.Intn(2) // Random starting player
+	}
+	g.Hash = g.ComputeHash()
+	g.Start = Start{Board: CopyBoard(g.Board), Player: g.CurrentPlayer, Captured: g.Captured, Time: time.Now()}
+	g.positions = nil
 }
 
-func (g *Game) MakeMove(column int) (bool, int, error) {
+// Variant returns the game's variant, VariantStandard unless set otherwise
+func (g *Game) Variant() string {
+	return g.Settings.variant()
+}
+
+// Play makes a move for the current player by the game's rules. It returns
+// whether the move was made and the row it was made in.
+func (g *Game) Play(a Action) (bool, int, error) {
 	if g.Status != "playing" {
 		return false, -1, &GameError{"game is not active"}
 	}
-
-	if column < 0 || column >= 7 {
-		return false, -1, &GameError{"invalid column"}
-	}
-
-	// Find the lowest available row in the column
-	row := -1
-	for r := 5; r >= 0; r-- {
-		if g.Board[r][column] == 0 {
-			row = r
-			break
-		}
+	if a.Kind == "" {
+		a.Kind = KindDrop
 	}
 
-	if row == -1 {
-		return false, -1, &GameError{"column is full"}
+	rules := g.Rules()
+	m, err := rules.Apply(g, a)
+	if err != nil {
+		return false, -1, err
 	}
+	g.recordMove(m)
 
-	// Place the disc (1 for player1, 2 for player2)
-	g.Board[row][column] = g.CurrentPlayer + 1
-	g.LastMoveAt = time.Now()
-
-	// Check for win
-	if g.CheckWin(row, column) {
+	outcome := rules.Outcome(g)
+	if outcome.Finished {
 		g.Status = "finished"
-		g.Winner = g.CurrentPlayer
-		return true, row, nil
+		g.Winner = outcome.Winner
+	} else if outcome.Next != g.CurrentPlayer {
+		g.CurrentPlayer = outcome.Next
+		g.Hash ^= zobristSide
 	}
+	g.positions = append(g.positions, g.Hash)
+	return true, m.Row, nil
+}
 
-	// Check for draw
-	if g.IsBoardFull() {
-		g.Status = "finished"
-		g.Winner = -1 // Draw
-		return true, row, nil
+// Forfeit ends the game in progress as a loss for the player in seat.
+func (g *Game) Forfeit(seat int) error {
+	if g.Status != "playing" {
+		return &GameError{"game is not active"}
 	}
+	g.Status = "finished"
+	g.Winner = 1 - seat
+	g.Result = ResultForfeit
+	return nil
+}
+
+// MakeMove drops a disc into column for the current player
+func (g *Game) MakeMove(column int) (bool, int, error) {
+	return g.Play(Drop(column))
+}
 
-	// Switch player
-	g.CurrentPlayer = 1 - g.CurrentPlayer
-	return true, row, nil
+// PopOut pops the current player's disc out of the bottom of column, in
+// variants that allow it
+func (g *Game) PopOut(column int) (bool, int, error) {
+	return g.Play(Pop(column))
 }
 
+// CheckWin reports whether the disc at (row, col) is part of a line of
+// Size.Connect discs. On a cylinder board lines may wrap from the last
+// column to the first.
 func (g *Game) CheckWin(row, col int) bool {
 	player := g.Board[row][col]
 	if player == 0 {
 		return false
 	}
+	wrap := g.wraps()
 
-	// Check horizontal
-	count := 0
-	for c := 0; c < 7; c++ {
-		if g.Board[row][c] == player {
-			count++
-			if count == 4 {
-				return true
-			}
-		} else {
-			count = 0
+	// Horizontal, vertical and both diagonals
+	directions := [4][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}}
+	for _, d := range directions {
+		// A wrapped row is a ring: counting past its length would count
+		// discs twice
+		limit := g.Size.Connect
+		if wrap && d[0] == 0 && g.Size.Columns < limit {
+			limit = g.Size.Columns
 		}
-	}
-
-	// Check vertical
-	count = 0
-	for r := 0; r < 6; r++ {
-		if g.Board[r][col] == player {
-			count++
-			if count == 4 {
-				return true
+		count := 1
+		for _, sign := range [2]int{1, -1} {
+			r, c := row+sign*d[0], col+sign*d[1]
+			for count < limit && r >= 0 && r < g.Size.Rows {
+				if wrap {
+					c = (c + g.Size.Columns) % g.Size.Columns
+				} else if c < 0 || c >= g.Size.Columns {
+					break
+				}
+				if g.Board[r][c] != player {
+					break
+				}
+				count++
+				r += sign * d[0]
+				c += sign * d[1]
 			}
-		} else {
-			count = 0
 		}
-	}
-
-	// Check diagonal (top-left to bottom-right)
-	count = 0
-	startRow, startCol := row, col
-	for startRow > 0 && startCol > 0 {
-		startRow--
-		startCol--
-	}
-
-	for startRow < 6 && startCol < 7 {
-		if g.Board[startRow][startCol] == player {
-			count++
-			if count == 4 {
-				return true
-			}
-		} else {
-			count = 0
+		if count >= g.Size.Connect {
+			return true
 		}
-		startRow++
-		startCol++
 	}
-
-	// Check diagonal (top-right to bottom-left)
-	count = 0
-	startRow, startCol = row, col
-	for startRow > 0 && startCol < 6 {
-		startRow--
-		startCol++
-	}
-
-	for startRow < 6 && startCol >= 0 {
-		if g.Board[startRow][startCol] == player {
-			count++
-			if count == 4 {
-				return true
-			}
-		} else {
-			count = 0
-		}
-		startRow++
-		startCol--
-	}
-
 	return false
 }
 
 func (g *Game) IsBoardFull() bool {
-	for c := 0; c < 7; c++ {
+	for c := 0; c < g.Size.Columns; c++ {
 		if g.Board[0][c] == 0 {
 			return false
 		}
@@ -191,6 +311,16 @@ func (g *Game) ToJSON() ([]byte, error) {
 	return json.Marshal(g)
 }
 
+// Clone returns a deep copy of g, safe to read while g keeps changing
+func (g *Game) Clone() *Game {
+	clone := *g
+	clone.Board = CopyBoard(g.Board)
+	clone.Start.Board = CopyBoard(g.Start.Board)
+	clone.Moves = append([]Move(nil), g.Moves...)
+	clone.positions = append([]uint64(nil), g.positions...)
+	return &clone
+}
+
 func (g *Game) GetCurrentPlayer() Player {
 	return g.Players[g.CurrentPlayer]
 }
@@ -0,0 +1,146 @@
+package game
+
+import (
+	"fmt"
+	"time"
+)
+
+// Start is the position a game began from. Together with the move list it
+// is a complete record of the game.
+type Start struct {
+	Board    [][]int   `json:"board"`
+	Player   int       `json:"player"`   // index of the player to move first
+	Captured [2]int    `json:"captured"` // Pop Ten: discs already kept
+	Time     time.Time `json:"time"`
+}
+
+// recordMove appends m, the move the current player just made, to the
+// history, filling in who made it and when.
+func (g *Game) recordMove(m Move) {
+	now := time.Now()
+	since := g.Start.Time
+	if len(g.Moves) > 0 {
+		since = g.Moves[len(g.Moves)-1].Timestamp
+	}
+
+	var thinkTime int64
+	if !since.IsZero() {
+		thinkTime = now.Sub(since).Milliseconds()
+	}
+
+	m.PlayerID = g.Players[g.CurrentPlayer].ID
+	m.Player = g.CurrentPlayer
+	m.Timestamp = now
+	m.ThinkTimeMs = thinkTime
+	g.Moves = append(g.Moves, m)
+	g.LastMoveAt = now
+}
+
+// SetPosition makes a copy of board, with player to move, the starting
+// position of g and clears its history. The board's shape becomes g's; the
+// connect length is kept.
+func (g *Game) SetPosition(board [][]int, player int) {
+	g.Board = CopyBoard(board)
+	g.Size.Rows, g.Size.Columns = len(board), len(board[0])
+	g.CurrentPlayer = player
+	g.Hash = g.ComputeHash()
+	g.Moves = nil
+	g.positions = nil
+	g.Start = Start{Board: CopyBoard(board), Player: player, Time: time.Now()}
+}
+
+// Replay rebuilds a game of the given size and settings by playing moves from
+// start. Each move must be played by the recorded player and land in the
+// recorded row. The recorded timestamps and think times are kept.
+func Replay(id string, size Size, settings Settings, players [2]Player, start Start, moves []Move) (*Game, error) {
+	g := NewGameWithSize(id, players[0], size)
+	g.Players = players
+	g.Settings = settings
+	g.Status = "playing"
+	g.SetPosition(start.Board, start.Player)
+	g.Captured = start.Captured
+	g.Start = Start{Board: CopyBoard(start.Board), Player: start.Player, Captured: start.Captured, Time: start.Time}
+
+	for i, m := range moves {
+		if g.Status != "playing" {
+			return nil, &GameError{fmt.Sprintf("move %d played after the game ended", i+1)}
+		}
+		if m.Player != g.CurrentPlayer {
+			return nil, &GameError{fmt.Sprintf("move %d played out of turn", i+1)}
+		}
+		_, row, err := g.Play(m.Action())
+		if err != nil {
+			return nil, &GameError{fmt.Sprintf("move %d: %v", i+1, err)}
+		}
+		if row != m.Row {
+			return nil, &GameError{fmt.Sprintf("move %d landed in row %d, recorded %d", i+1, row, m.Row)}
+		}
+		g.Moves[i] = m
+	}
+	if len(moves) > 0 {
+		g.LastMoveAt = moves[len(moves)-1].Timestamp
+	}
+	return g, nil
+}
+
+// Verify replays g's history from its start and checks that it produces g's
+// current board, side to move, kept discs and result. A forfeited game must
+// still have been in progress.
+func (g *Game) Verify() error {
+	if g.Status == "waiting" {
+		return nil
+	}
+	replayed, err := Replay(g.ID, g.Size, g.Settings, g.Players, g.Start, g.Moves)
+	if err != nil {
+		return err
+	}
+	if !BoardsEqual(replayed.Board, g.Board) {
+		return &GameError{"board doesn't match the move history"}
+	}
+	if replayed.CurrentPlayer != g.CurrentPlayer {
+		return &GameError{"side to move doesn't match the move history"}
+	}
+	if replayed.Captured != g.Captured {
+		return &GameError{"kept discs don't match the move history"}
+	}
+	if g.Result == ResultForfeit {
+		if replayed.Status != "playing" {
+			return &GameError{"game was already over when it was forfeited"}
+		}
+	} else if replayed.Status != g.Status || replayed.Winner != g.Winner {
+		return &GameError{"result doesn't match the move history"}
+	}
+	return nil
+}
+
+// Undo takes back the last n moves, reopening the game if one of them ended
+// it.
+func (g *Game) Undo(n int) error {
+	if g.Status == "waiting" {
+		return &GameError{"game has not started"}
+	}
+	if n < 1 || n > len(g.Moves) {
+		return &GameError{"not enough moves to take back"}
+	}
+
+	// Moves like pops can't simply be lifted off the board, so replay the
+	// moves that stay
+	replayed, err := Replay(g.ID, g.Size, g.Settings, g.Players, g.Start, g.Moves[:len(g.Moves)-n])
+	if err != nil {
+		return err
+	}
+	g.Board = replayed.Board
+	g.CurrentPlayer = replayed.CurrentPlayer
+	g.Captured = replayed.Captured
+	g.Hash = replayed.Hash
+	g.Moves = replayed.Moves
+	g.positions = replayed.positions
+	g.Status = "playing"
+	g.Winner = -1
+	g.Result = ""
+	g.LastMoveAt = g.Start.Time
+	if len(g.Moves) > 0 {
+		g.LastMoveAt = g.Moves[len(g.Moves)-1].Timestamp
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package game
+
+import "testing"
+
+// playGame starts a game from position and plays moves in move notation
+func playGame(t *testing.T, position, moves string) *Game {
+	t.Helper()
+	p, err := ParsePosition(position)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := NewGameFromPosition("test", Player{ID: "a"}, p)
+	g.AddPlayer(Player{ID: "b"})
+	actions, err := ParseMoves(moves)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, a := range actions {
+		if _, _, err := g.Play(a); err != nil {
+			t.Fatalf("move %d (%s): %v", i+1, a, err)
+		}
+	}
+	return g
+}
+
+const emptyBoard = "7/7/7/7/7/7 x standard"
+
+// A full Pop Ten board where x, to move, keeps a disc by popping any of the
+// four at the left of the bottom row
+const popTenFull = "xoxoxox/oxoxoxo/xoxoxox/oxoxoxo/oxoxoxo/xxxxooo x popten"
+
+func TestReplay(t *testing.T) {
+	for _, test := range []struct{ position, moves string }{
+		{emptyBoard, "4453627"},
+		{emptyBoard, "1212121"}, // ends with a win
+		{"7/7/7/7/7/7 x popout", "44p4"},
+		{popTenFull, "p1p2p5"},
+	} {
+		g := playGame(t, test.position, test.moves)
+		replayed, err := Replay(g.ID, g.Size, g.Settings, g.Players, g.Start, g.Moves)
+		if err != nil {
+			t.Errorf("%s %s: %v", test.position, test.moves, err)
+			continue
+		}
+		if !BoardsEqual(replayed.Board, g.Board) {
+			t.Errorf("%s %s: replayed board %v, want %v", test.position, test.moves, replayed.Board, g.Board)
+		}
+		if replayed.CurrentPlayer != g.CurrentPlayer || replayed.Hash != g.Hash || replayed.Captured != g.Captured {
+			t.Errorf("%s %s: replayed state differs", test.position, test.moves)
+		}
+		if replayed.Status != g.Status || replayed.Winner != g.Winner {
+			t.Errorf("%s %s: replayed %s with winner %d, want %s with winner %d",
+				test.position, test.moves, replayed.Status, replayed.Winner, g.Status, g.Winner)
+		}
+		if err := g.Verify(); err != nil {
+			t.Errorf("%s %s: %v", test.position, test.moves, err)
+		}
+	}
+}
+
+func TestVerifyTamperedHistory(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		tamper func(g *Game)
+	}{
+		{"wrong row", func(g *Game) { g.Moves[1].Row-- }},
+		{"wrong player", func(g *Game) { g.Moves[2].Player = 1 - g.Moves[2].Player }},
+		{"wrong column", func(g *Game) { g.Moves[3].Column = 0 }},
+		{"missing move", func(g *Game) { g.Moves = g.Moves[:len(g.Moves)-1] }},
+		{"wrong board", func(g *Game) { g.Board[0][0] = 1 }},
+	} {
+		g := playGame(t, emptyBoard, "4453")
+		test.tamper(g)
+		if err := g.Verify(); err == nil {
+			t.Errorf("%s: history verified", test.name)
+		}
+	}
+}
+
+func TestUndo(t *testing.T) {
+	for _, test := range []struct{ position, before, undone string }{
+		{emptyBoard, "445", "36"},
+		{emptyBoard, "121212", "1"}, // takes back the win
+		{"7/7/7/7/7/7 x popout", "4455", "p4"},
+		{popTenFull, "p1", "p2"}, // takes back a kept disc and the extra turn
+	} {
+		want := playGame(t, test.position, test.before)
+		g := playGame(t, test.position, test.before+test.undone)
+		undone, _ := ParseMoves(test.undone)
+		if err := g.Undo(len(undone)); err != nil {
+			t.Errorf("%s %s: %v", test.position, test.before+test.undone, err)
+			continue
+		}
+
+		if !BoardsEqual(g.Board, want.Board) {
+			t.Errorf("%s: board %v after undo, want %v", test.position, g.Board, want.Board)
+		}
+		if g.CurrentPlayer != want.CurrentPlayer {
+			t.Errorf("%s: %d to move after undo, want %d", test.position, g.CurrentPlayer, want.CurrentPlayer)
+		}
+		if g.Hash != want.Hash || g.Hash != g.ComputeHash() {
+			t.Errorf("%s: hash %x after undo, want %x", test.position, g.Hash, want.Hash)
+		}
+		if g.Captured != want.Captured {
+			t.Errorf("%s: kept discs %v after undo, want %v", test.position, g.Captured, want.Captured)
+		}
+		if g.Status != "playing" || g.Winner != -1 || len(g.Moves) != len(want.Moves) {
+			t.Errorf("%s: %s with winner %d and %d moves after undo", test.position, g.Status, g.Winner, len(g.Moves))
+		}
+	}
+
+	g := playGame(t, emptyBoard, "44")
+	if err := g.Undo(3); err == nil {
+		t.Error("took back more moves than were played")
+	}
+}
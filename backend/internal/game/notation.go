@@ -0,0 +1,349 @@
+package game
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Games and positions can be written as text.
+//
+// Move notation lists the columns played, 1-based, with nothing in between:
+// "4453" is two discs in the middle column followed by columns 5 and 3. In
+// variants with pops a pop is its column with a "p" in front: "4453p4" ends
+// by popping the bottom disc of the middle column.
+//
+// Position notation is a board, the side to move and the variant separated
+// by spaces, e.g. "7/7/7/7/3o3/2xx3 o standard". Rows go from top to bottom
+// separated by "/"; "x" is a disc of the first player, "o" one of the second
+// and a digit a run of that many empty cells. The side to move is "x" or "o".
+// The board's shape gives the size; a further field gives the connect length
+// when it isn't 4, e.g. "9/9/9/9/9/9/9 x standard 5", and another the discs
+// each player has kept when either has, e.g. "... o popten 3-2".
+
+// Position is a board with the side to move, as written in position notation
+type Position struct {
+	Size     Size
+	Board    [][]int
+	Player   int // side to move, 0 or 1
+	Variant  string
+	Captured [2]int // discs each player has kept, in Pop Ten
+}
+
+// discSymbols maps board cells to their letters, and back
+var discSymbols = [3]byte{0, 'x', 'o'}
+
+// String formats p in position notation
+func (p Position) String() string {
+	var sb strings.Builder
+	for row := 0; row < p.Size.Rows; row++ {
+		if row > 0 {
+			sb.WriteByte('/')
+		}
+		empty := 0
+		for col := 0; col < p.Size.Columns; col++ {
+			if p.Board[row][col] == 0 {
+				empty++
+				continue
+			}
+			if empty > 0 {
+				sb.WriteString(strconv.Itoa(empty))
+				empty = 0
+			}
+			sb.WriteByte(discSymbols[p.Board[row][col]])
+		}
+		if empty > 0 {
+			sb.WriteString(strconv.Itoa(empty))
+		}
+	}
+	sb.WriteByte(' ')
+	sb.WriteByte(discSymbols[p.Player+1])
+	sb.WriteByte(' ')
+	sb.WriteString(p.Variant)
+	if p.Size.Connect != StandardSize.Connect {
+		sb.WriteByte(' ')
+		sb.WriteString(strconv.Itoa(p.Size.Connect))
+	}
+	if p.Captured != [2]int{} {
+		fmt.Fprintf(&sb, " %d-%d", p.Captured[0], p.Captured[1])
+	}
+	return sb.String()
+}
+
+// ParsePosition reads a position in position notation. It rejects boards
+// that can't arise in a game of the variant; see Validate.
+func ParsePosition(s string) (Position, error) {
+	var p Position
+	fields := strings.Fields(s)
+	if len(fields) < 3 || len(fields) > 5 {
+		return p, &GameError{"position needs a board, a side to move and a variant"}
+	}
+
+	rows := strings.Split(fields[0], "/")
+	var cells [][]int
+	for row, line := range rows {
+		var cellsInRow []int
+		lastDigit := false
+		for i := 0; i < len(line); i++ {
+			c := line[i]
+			switch {
+			case c == 'x':
+				cellsInRow = append(cellsInRow, 1)
+				lastDigit = false
+			case c == 'o':
+				cellsInRow = append(cellsInRow, 2)
+				lastDigit = false
+			case c >= '1' && c <= '9':
+				if lastDigit {
+					return p, &GameError{fmt.Sprintf("row %d has adjacent empty runs", row+1)}
+				}
+				cellsInRow = append(cellsInRow, make([]int, c-'0')...)
+				lastDigit = true
+			default:
+				return p, &GameError{fmt.Sprintf("invalid character %q in row %d", c, row+1)}
+			}
+		}
+		if row > 0 && len(cellsInRow) != len(cells[0]) {
+			return p, &GameError{fmt.Sprintf("row %d must have %d cells like the first", row+1, len(cells[0]))}
+		}
+		cells = append(cells, cellsInRow)
+	}
+
+	p.Size = Size{Rows: len(cells), Columns: len(cells[0]), Connect: StandardSize.Connect}
+	for i, field := range fields[3:] {
+		if first, second, ok := strings.Cut(field, "-"); ok {
+			captured, err := parseCaptured(first, second)
+			if err != nil {
+				return p, err
+			}
+			p.Captured = captured
+			continue
+		}
+		if i > 0 {
+			return p, &GameError{"connect length must come before the kept discs"}
+		}
+		connect, err := strconv.Atoi(field)
+		if err != nil {
+			return p, &GameError{"connect length must be a number"}
+		}
+		p.Size.Connect = connect
+	}
+	if err := p.Size.Validate(); err != nil {
+		return p, err
+	}
+	p.Board = NewBoard(p.Size)
+	for row := range cells {
+		copy(p.Board[row], cells[row])
+	}
+
+	switch fields[1] {
+	case "x":
+		p.Player = 0
+	case "o":
+		p.Player = 1
+	default:
+		return p, &GameError{"side to move must be x or o"}
+	}
+
+	variant, err := ParseVariant(fields[2])
+	if err != nil {
+		return p, err
+	}
+	p.Variant = variant
+
+	if err := p.Validate(); err != nil {
+		return Position{}, err
+	}
+	return p, nil
+}
+
+// parseCaptured reads the two counts of kept discs in a position
+func parseCaptured(first, second string) ([2]int, error) {
+	var captured [2]int
+	for i, count := range [2]string{first, second} {
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 0 {
+			return [2]int{}, &GameError{"kept discs must be two counts like 3-2"}
+		}
+		captured[i] = n
+	}
+	return captured, nil
+}
+
+// Validate rejects positions that can't arise in a game of p's variant,
+// such as floating discs, and boards that don't match p.Size. Each variant
+// adds its own checks; in Connect Four the disc counts must match the side
+// to move and the side to move can't have a winning line. A position won by
+// the side that just moved is accepted; see Over.
+func (p Position) Validate() error {
+	rules, ok := LookupRules(p.Variant)
+	if !ok {
+		return &GameError{"unknown variant: " + p.Variant}
+	}
+	if err := rules.CheckSize(p.Size); err != nil {
+		return err
+	}
+	if len(p.Board) != p.Size.Rows {
+		return &GameError{fmt.Sprintf("board must have %d rows", p.Size.Rows)}
+	}
+	for row := range p.Board {
+		if len(p.Board[row]) != p.Size.Columns {
+			return &GameError{fmt.Sprintf("board rows must have %d cells", p.Size.Columns)}
+		}
+		for _, disc := range p.Board[row] {
+			if disc < 0 || disc > 2 {
+				return &GameError{"board cells must be 0, 1 or 2"}
+			}
+		}
+	}
+	if p.Player != 0 && p.Player != 1 {
+		return &GameError{"side to move must be 0 or 1"}
+	}
+
+	for col := 0; col < p.Size.Columns; col++ {
+		for row := 0; row < p.Size.Rows-1; row++ {
+			if p.Board[row][col] != 0 && p.Board[row+1][col] == 0 {
+				return &GameError{fmt.Sprintf("floating disc in column %d", col+1)}
+			}
+		}
+	}
+	return rules.CheckPosition(p)
+}
+
+// Over reports whether the game is already decided in p, by the rules of its
+// variant: in Connect Four, a player has a winning line or the side to move
+// has no legal move.
+func (p Position) Over() bool {
+	// Ask the rules as if the other side had just moved
+	g := p.game()
+	g.CurrentPlayer = 1 - p.Player
+	g.Hash = g.ComputeHash()
+	return g.Rules().Outcome(g).Finished
+}
+
+// Play applies moves, as read by ParseMoves, to p. It fails on an illegal
+// move or a move after the game has ended.
+func (p Position) Play(moves []Action) (Position, error) {
+	g := p.game()
+	if len(moves) > 0 && p.Over() {
+		return p, &GameError{"move 1 played after the game ended"}
+	}
+	for i, a := range moves {
+		if g.Status != "playing" {
+			return p, &GameError{fmt.Sprintf("move %d played after the game ended", i+1)}
+		}
+		if _, _, err := g.Play(a); err != nil {
+			return p, &GameError{fmt.Sprintf("move %d: %v", i+1, err)}
+		}
+	}
+	return g.Position(), nil
+}
+
+// game returns a scratch game in position p
+func (p Position) game() *Game {
+	g := &Game{Size: p.Size, Board: CopyBoard(p.Board), CurrentPlayer: p.Player, Status: "playing", Winner: -1, Captured: p.Captured}
+	g.Settings.Variant = p.Variant
+	g.Hash = g.ComputeHash()
+	g.Start = Start{Board: CopyBoard(p.Board), Player: p.Player, Captured: p.Captured}
+	return g
+}
+
+// Position returns g's current position. The side to move of a finished
+// game is the one that would move next.
+func (g *Game) Position() Position {
+	p := Position{Size: g.Size, Board: CopyBoard(g.Board), Player: g.CurrentPlayer, Variant: g.Settings.variant(), Captured: g.Captured}
+	if g.Status == "finished" && len(g.Moves) > 0 {
+		p.Player = 1 - g.Moves[len(g.Moves)-1].Player
+	}
+	return p
+}
+
+// ParseMoves reads move notation into moves with 0-based columns. It only
+// checks the characters; Position.Play checks the moves against the board.
+func ParseMoves(s string) ([]Action, error) {
+	moves := make([]Action, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		kind := KindDrop
+		if s[i] == 'p' {
+			kind = KindPop
+			i++
+			if i == len(s) {
+				return nil, &GameError{fmt.Sprintf("pop without a column at move %d", len(moves)+1)}
+			}
+		}
+		if s[i] < '1' || s[i] > '9' {
+			return nil, &GameError{fmt.Sprintf("invalid column %q at move %d", s[i], len(moves)+1)}
+		}
+		moves = append(moves, Action{Kind: kind, Column: int(s[i] - '1')})
+	}
+	return moves, nil
+}
+
+// FormatMoves writes moves in move notation
+func FormatMoves(moves []Move) string {
+	var sb strings.Builder
+	for _, m := range moves {
+		sb.WriteString(m.Action().String())
+	}
+	return sb.String()
+}
+
+// Action returns the move m made
+func (m Move) Action() Action {
+	if m.Kind == KindPop {
+		return Pop(m.Column)
+	}
+	return Drop(m.Column)
+}
+
+// String writes a in move notation
+func (a Action) String() string {
+	if a.Kind == KindPop {
+		return "p" + strconv.Itoa(a.Column+1)
+	}
+	return strconv.Itoa(a.Column + 1)
+}
+
+// Record writes g as a tagged game record: one [Tag "value"] line per
+// detail, then the moves in move notation.
+func (g *Game) Record() string {
+	result := "*"
+	if g.Status == "finished" {
+		result = map[int]string{-1: "1/2-1/2", 0: "1-0", 1: "0-1"}[g.Winner]
+	}
+	start := Position{Size: g.Size, Board: g.Start.Board, Player: g.Start.Player, Variant: g.Settings.variant(), Captured: g.Start.Captured}
+
+	var sb strings.Builder
+	tags := [][2]string{
+		{"Game", g.ID},
+		{"Date", g.CreatedAt.UTC().Format("2006-01-02")},
+		{"Variant", start.Variant},
+		{"Size", g.Size.String()},
+		{"Player1", g.Players[0].Username},
+		{"Player2", g.Players[1].Username},
+		{"Start", start.String()},
+		{"Result", result},
+	}
+	if g.Result != "" {
+		tags = append(tags, [2]string{"Termination", g.Result})
+	}
+	for _, tag := range tags {
+		fmt.Fprintf(&sb, "[%s %s]\n", tag[0], strconv.Quote(tag[1]))
+	}
+	sb.WriteByte('\n')
+	sb.WriteString(FormatMoves(g.Moves))
+	sb.WriteByte('\n')
+	return sb.String()
+}
+
+// NewGameFromPosition creates a game waiting for its second player that
+// starts from p rather than the empty board. p must not be decided already.
+func NewGameFromPosition(id string, player1 Player, p Position) *Game {
+	g := NewGameWithSize(id, player1, p.Size)
+	g.Board = CopyBoard(p.Board)
+	g.CurrentPlayer = p.Player
+	g.Captured = p.Captured
+	g.Settings.Variant = p.Variant
+	g.preset = true
+	return g
+}
@@ -0,0 +1,133 @@
+package game
+
+import "testing"
+
+func TestParsePosition(t *testing.T) {
+	for _, test := range []struct {
+		position string
+		ok       bool
+	}{
+		{"7/7/7/7/7/7 x standard", true},
+		{"7/7/7/7/3o3/2xx3 o standard", true},
+		{"7/7/7/7/3o3/2xx3 x standard", false},
+		{"7/7/7/7/7/3x3 o standard", true},
+		{"7/7/7/7/7/3x3 x standard", false},      // x has moved but is to move again
+		{"7/7/7/7/7/2xxx2 o standard", false},    // impossible disc counts
+		{"7/7/7/7/3x3/7 o standard", false},      // floating disc
+		{"7/7/7/7/7/3x2 o standard", false},      // short row
+		{"7/7/7/7/7/3z3 o standard", false},      // unknown disc
+		{"7/7/7/7/7/34 x standard", false},       // adjacent empty runs
+		{"7/7/7/7/7/7 y standard", false},        // unknown side to move
+		{"7/7/7/7/7/7 x chess", false},           // unknown variant
+		{"7/7/7/7/7/7 x", false},                 // no variant
+		{"7/7/x6/x5o/x5o/x5o o standard", true},  // x has just won
+		{"7/7/o6/o5x/o5x/o5x o standard", false}, // the side to move has a line
+		{"9/9/9/9/9/9/9 x standard 5", true},
+		{"9/9/9/9/9/9/9 x standard 7", false}, // connect length too long
+		{"9/9/9/9/9/9/9 x standard five", false},
+		{"7/7/7/7/7/7 x standard 3-2", false}, // kept discs in standard
+		{"xoxoxox/oxoxoxo/xoxoxox/oxoxoxo/oxoxoxo/xxxxooo x popten", true},
+		{"1oxoxox/xxoxoxo/ooxoxox/xxoxoxo/oxoxoxo/oxxxooo x popten 1-0", true},
+		{"1oxoxox/xxoxoxo/ooxoxox/xxoxoxo/oxoxoxo/oxxxooo x popten 2-0", false}, // counts don't add up
+		{"1oxoxox/xxoxoxo/ooxoxox/xxoxoxo/oxoxoxo/oxxxooo x popten 1-0x", false},
+		{"1oxoxox/xxoxoxo/ooxoxox/xxoxoxo/oxoxoxo/oxxxooo x popten 1x-0", false},
+		{"1oxoxox/xxoxoxo/ooxoxox/xxoxoxo/oxoxoxo/oxxxooo x popten 1-0-0", false},
+		{"1oxoxox/xxoxoxo/ooxoxox/xxoxoxo/oxoxoxo/oxxxooo x popten -1-0", false},
+		{"7/7/7/7/xo5/ox5 x popten", false}, // the bottom row must fill first
+		{"7/7/7/7/7/xxxx3 x popout", true},  // PopOut boards can have any counts
+	} {
+		_, err := ParsePosition(test.position)
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("ParsePosition(%q): %v, want ok %t", test.position, err, test.ok)
+		}
+	}
+}
+
+func TestPositionPlay(t *testing.T) {
+	for _, test := range []struct {
+		position, moves string
+		ok              bool
+	}{
+		{"7/7/7/7/7/7 x standard", "4444443", true},
+		{"7/7/7/7/7/7 x standard", "44444444", false}, // column full
+		{"7/7/7/7/7/7 x standard", "1212121", true},
+		{"7/7/7/7/7/7 x standard", "12121212", false}, // played after the win
+		{"7/7/7/7/7/7 x standard", "8", false},        // off the board
+		{"7/7/7/7/7/7 x standard", "4p4", false},      // no pops in standard
+		{"7/7/7/7/7/7 x popout", "4p4", false},        // can't pop the other's disc
+		{"7/7/7/7/7/7 x popout", "45p4", true},
+		{"7/7/x6/x5o/x5o/x5o o standard", "7", false}, // already decided
+		{"xoxoxox/oxoxoxo/xoxoxox/oxoxoxo/oxoxoxo/xxxxooo x popten", "1", false},
+		{"xoxoxox/oxoxoxo/xoxoxox/oxoxoxo/oxoxoxo/xxxxooo x popten", "p1", true},
+	} {
+		p, err := ParsePosition(test.position)
+		if err != nil {
+			t.Fatalf("ParsePosition(%q): %v", test.position, err)
+		}
+		moves, err := ParseMoves(test.moves)
+		if err != nil {
+			t.Fatalf("ParseMoves(%q): %v", test.moves, err)
+		}
+		if _, err := p.Play(moves); (err == nil) != test.ok {
+			t.Errorf("%s then %s: %v, want ok %t", test.position, test.moves, err, test.ok)
+		}
+	}
+}
+
+func TestParseMoves(t *testing.T) {
+	for _, s := range []string{"", "4453", "p4", "12p34p5"} {
+		moves, err := ParseMoves(s)
+		if err != nil {
+			t.Errorf("ParseMoves(%q): %v", s, err)
+			continue
+		}
+		var formatted string
+		for _, a := range moves {
+			formatted += a.String()
+		}
+		if formatted != s {
+			t.Errorf("ParseMoves(%q) formats as %q", s, formatted)
+		}
+	}
+	for _, s := range []string{"0", "4a", "p", "44p", "pp4", "4 4"} {
+		if _, err := ParseMoves(s); err == nil {
+			t.Errorf("ParseMoves(%q) accepted", s)
+		}
+	}
+}
+
+func TestRoundTrips(t *testing.T) {
+	for _, test := range []struct{ position, moves string }{
+		{"7/7/7/7/7/7 x standard", "4453627"},
+		{"7/7/7/7/7/3x3 o standard", "4455"},
+		{"9/9/9/9/9/9/9 x standard 5", "55546"},
+		{"7/7/7/7/7/7 x popout", "4455p4"},
+		{"xoxoxox/oxoxoxo/xoxoxox/oxoxoxo/oxoxoxo/xxxxooo x popten", "p1p2p5"},
+	} {
+		g := playGame(t, test.position, test.moves)
+
+		if got := FormatMoves(g.Moves); got != test.moves {
+			t.Errorf("%s: moves formatted as %q, want %q", test.position, got, test.moves)
+		}
+
+		p := g.Position()
+		parsed, err := ParsePosition(p.String())
+		if err != nil {
+			t.Errorf("%s then %s: reading back %q: %v", test.position, test.moves, p.String(), err)
+			continue
+		}
+		if parsed.String() != p.String() || !BoardsEqual(parsed.Board, p.Board) ||
+			parsed.Size != p.Size || parsed.Player != p.Player || parsed.Captured != p.Captured {
+			t.Errorf("%s then %s: %q read back as %q", test.position, test.moves, p.String(), parsed.String())
+		}
+
+		start, _ := ParsePosition(test.position)
+		moves, _ := ParseMoves(test.moves)
+		played, err := start.Play(moves)
+		if err != nil {
+			t.Errorf("%s then %s: %v", test.position, test.moves, err)
+		} else if played.String() != p.String() {
+			t.Errorf("%s then %s: Position.Play gives %q, the game %q", test.position, test.moves, played.String(), p.String())
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package game
+
+import "fmt"
+
+// PopTenRules are Pop Ten, played on the standard board in two phases.
+// First the players take turns filling the board from the bottom up: a disc
+// must go into the lowest row that still has room, and lines count for
+// nothing. Once the board is full they take turns popping their own discs
+// out of the bottom row. A popped disc that was part of a line is kept and
+// its owner moves again; any other popped disc goes back on top of the
+// column it came from. The first to keep PopTenTarget discs wins. A player
+// with nothing to pop passes the move, and as pops that keep nothing just
+// cycle discs, a position that comes up RepetitionLimit times is a draw.
+type PopTenRules struct{}
+
+// PopTen is the Pop Ten variant
+var PopTen = PopTenRules{}
+
+// PopTenTarget is how many discs a player must keep to win Pop Ten
+const PopTenTarget = 10
+
+func (PopTenRules) Name() string {
+	return VariantPopTen
+}
+
+func (PopTenRules) DefaultSize() Size {
+	return StandardSize
+}
+
+func (PopTenRules) CheckSize(size Size) error {
+	if size != StandardSize {
+		return &GameError{fmt.Sprintf("%s is played on %s", VariantPopTen, StandardSize)}
+	}
+	return nil
+}
+
+func (PopTenRules) Setup(size Size) [][]int {
+	return NewBoard(size)
+}
+
+func (PopTenRules) LegalMoves(g *Game) []Action {
+	var actions []Action
+	if row := fillRow(g); row != -1 {
+		for col := 0; col < g.Size.Columns; col++ {
+			if g.Board[row][col] == 0 {
+				actions = append(actions, Drop(col))
+			}
+		}
+		return actions
+	}
+	for col := 0; col < g.Size.Columns; col++ {
+		if g.Board[g.Size.Rows-1][col] == g.CurrentPlayer+1 {
+			actions = append(actions, Pop(col))
+		}
+	}
+	return actions
+}
+
+func (PopTenRules) Apply(g *Game, a Action) (Move, error) {
+	if a.Column < 0 || a.Column >= g.Size.Columns {
+		return Move{}, &GameError{"invalid column"}
+	}
+	fill := fillRow(g)
+
+	switch a.Kind {
+	case KindDrop:
+		if fill == -1 {
+			return Move{}, &GameError{"the board has been filled, pop one of your discs"}
+		}
+		row := g.dropRow(a.Column)
+		if row == -1 {
+			return Move{}, &GameError{"column is full"}
+		}
+		if row != fill {
+			return Move{}, &GameError{"fill the lowest row first"}
+		}
+		g.setCell(row, a.Column, g.CurrentPlayer+1)
+		return Move{Kind: KindDrop, Column: a.Column, Row: row}, nil
+
+	case KindPop:
+		if fill != -1 {
+			return Move{}, &GameError{"discs can only be popped once the board is full"}
+		}
+		row := g.Size.Rows - 1
+		disc := g.CurrentPlayer + 1
+		if g.Board[row][a.Column] != disc {
+			return Move{}, &GameError{"you can only pop your own disc"}
+		}
+		kept := g.CheckWin(row, a.Column)
+		g.popColumn(a.Column)
+		if kept {
+			g.Captured[g.CurrentPlayer]++
+		} else {
+			g.setCell(g.dropRow(a.Column), a.Column, disc)
+		}
+		return Move{Kind: KindPop, Column: a.Column, Row: row, Kept: kept}, nil
+	}
+	return Move{}, &GameError{"unknown move kind: " + a.Kind}
+}
+
+func (PopTenRules) Outcome(g *Game) Outcome {
+	mover := g.CurrentPlayer
+	if g.Captured[mover] >= PopTenTarget {
+		return Outcome{Finished: true, Winner: mover}
+	}
+
+	next := 1 - mover
+	if n := len(g.Moves); n > 0 && g.Moves[n-1].Kept {
+		next = mover
+	}
+	if !popTenCanMove(g, next) {
+		next = 1 - next
+		if !popTenCanMove(g, next) {
+			return Outcome{Finished: true, Winner: -1}
+		}
+	}
+	if g.repetitions(next) >= RepetitionLimit {
+		return Outcome{Finished: true, Winner: -1}
+	}
+	return Outcome{Next: next}
+}
+
+// CheckPosition checks that the board fills from the bottom up and that the
+// disc counts fit the side to move while filling, and once the board has
+// been filled that each player's discs on the board and kept add up to half
+// the board.
+func (PopTenRules) CheckPosition(p Position) error {
+	var count [3]int
+	for _, row := range p.Board {
+		for _, disc := range row {
+			count[disc]++
+		}
+	}
+
+	if p.Captured == [2]int{} && count[0] > 0 {
+		for row := 0; row < p.Size.Rows-1; row++ {
+			if !rowEmpty(p.Board[row]) && !rowFull(p.Board[row+1]) {
+				return &GameError{"rows must be filled from the bottom up"}
+			}
+		}
+		mover, other := count[p.Player+1], count[2-p.Player]
+		if mover != other && mover+1 != other {
+			return &GameError{"disc counts don't match the side to move"}
+		}
+		return nil
+	}
+
+	half := p.Size.Cells() / 2
+	for player := 0; player < 2; player++ {
+		if p.Captured[player] > PopTenTarget {
+			return &GameError{fmt.Sprintf("no one keeps more than %d discs", PopTenTarget)}
+		}
+		if count[player+1]+p.Captured[player] != half {
+			return &GameError{fmt.Sprintf("each player's discs on the board and kept must add up to %d", half)}
+		}
+	}
+	return nil
+}
+
+// fillRow returns the row Pop Ten discs are being dropped into, the lowest
+// with room, or -1 once the board has been filled. Keeping discs empties
+// cells again, but the board is never refilled.
+func fillRow(g *Game) int {
+	if g.Captured != [2]int{} {
+		return -1
+	}
+	for row := g.Size.Rows - 1; row >= 0; row-- {
+		if !rowFull(g.Board[row]) {
+			return row
+		}
+	}
+	return -1
+}
+
+// popTenCanMove reports whether player has a legal Pop Ten move on g's board
+func popTenCanMove(g *Game, player int) bool {
+	if fillRow(g) != -1 {
+		return true
+	}
+	for _, disc := range g.Board[g.Size.Rows-1] {
+		if disc == player+1 {
+			return true
+		}
+	}
+	return false
+}
+
+func rowFull(row []int) bool {
+	for _, disc := range row {
+		if disc == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func rowEmpty(row []int) bool {
+	for _, disc := range row {
+		if disc != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package game
+
+import "testing"
+
+func TestPopTenFillPhase(t *testing.T) {
+	g := playGame(t, "7/7/7/7/7/7 x popten", "45")
+	if _, _, err := g.Play(Drop(3)); err == nil {
+		t.Error("dropped a disc above a row that isn't full")
+	}
+	if _, _, err := g.Play(Pop(3)); err == nil {
+		t.Error("popped a disc before the board was full")
+	}
+	if len(g.Moves) != 2 || g.CurrentPlayer != 0 {
+		t.Errorf("%d moves with %d to move after refused moves, want 2 with x to move", len(g.Moves), g.CurrentPlayer)
+	}
+
+	// x fills the left of the bottom row, but lines count for nothing yet
+	g = playGame(t, "7/7/7/7/7/7 x popten", "1526374")
+	if g.Status != "playing" || g.Captured != [2]int{} {
+		t.Errorf("%s with %v kept after four in a row while filling", g.Status, g.Captured)
+	}
+	actions := g.LegalActions()
+	if len(actions) != g.Size.Columns {
+		t.Errorf("%d legal moves with the second row empty, want %d", len(actions), g.Size.Columns)
+	}
+	for _, a := range actions {
+		if a.Kind != KindDrop || g.dropRow(a.Column) != g.Size.Rows-2 {
+			t.Errorf("%s is legal while filling the second row", a)
+		}
+	}
+}
+
+func TestPopTenPopPhase(t *testing.T) {
+	g := playGame(t, popTenFull, "")
+	if _, _, err := g.Play(Drop(0)); err == nil {
+		t.Error("dropped a disc into a full board")
+	}
+	if _, _, err := g.Play(Pop(4)); err == nil {
+		t.Error("popped the other player's disc")
+	}
+
+	// The popped disc was in x's line along the bottom, so x keeps it and
+	// moves again
+	g = playGame(t, popTenFull, "p1")
+	if m := g.Moves[0]; !m.Kept || g.Captured != [2]int{1, 0} || g.CurrentPlayer != 0 {
+		t.Errorf("kept %t with %v kept and %d to move, want x to keep the disc and move again",
+			m.Kept, g.Captured, g.CurrentPlayer)
+	}
+	if g.Board[0][0] != 0 {
+		t.Errorf("kept disc left its column full")
+	}
+
+	// Without the line the next pop goes back on top and the turn passes
+	g = playGame(t, popTenFull, "p1p2")
+	if m := g.Moves[1]; m.Kept || g.Captured != [2]int{1, 0} || g.CurrentPlayer != 1 {
+		t.Errorf("kept %t with %v kept and %d to move, want the disc back on top and o to move",
+			m.Kept, g.Captured, g.CurrentPlayer)
+	}
+	if g.Board[0][1] != 1 {
+		t.Errorf("popped disc isn't back on top of its column: %v", g.Board)
+	}
+}
+
+func TestPopTenWin(t *testing.T) {
+	// x has kept nine discs and keeps a tenth
+	g := playGame(t, "7/2ooooo/oxoxoxo/oxoxoxo/ooxoxoo/xxxxooo x popten 9-0", "p1")
+	if g.Status != "finished" || g.Winner != 0 || g.Captured[0] != PopTenTarget {
+		t.Errorf("%s with winner %d and %v kept, want x to win with %d", g.Status, g.Winner, g.Captured, PopTenTarget)
+	}
+}
@@ -0,0 +1,181 @@
+package game
+
+import "sort"
+
+// Rules decide which moves are legal in a variant, what a move does to the
+// board and when the game is over. Game.Play drives them: Apply, then
+// Outcome, then the turn passes to Outcome's Next. Rules keep no state of
+// their own; everything lives in the Game.
+type Rules interface {
+	// Name is the variant's name, as stored in Settings.Variant and written
+	// in position notation.
+	Name() string
+	// DefaultSize is the board used when a game doesn't ask for one.
+	DefaultSize() Size
+	// CheckSize rejects boards the variant can't be played on.
+	CheckSize(size Size) error
+	// Setup returns the board a game of the variant starts from.
+	Setup(size Size) [][]int
+	// LegalMoves lists the moves open to g's current player.
+	LegalMoves(g *Game) []Action
+	// Apply makes a move for g's current player, updating the board, g.Hash
+	// and g.Captured, and describes it. The caller fills in who moved and
+	// when.
+	Apply(g *Game, a Action) (Move, error)
+	// Outcome decides what follows the move just played, while g's current
+	// player is still the one who made it. It also serves positions with no
+	// move history, to tell whether they are decided.
+	Outcome(g *Game) Outcome
+	// CheckPosition rejects positions that can't arise in the variant. The
+	// board's shape, its cell values and floating discs are already checked.
+	CheckPosition(p Position) error
+}
+
+// Outcome is what the rules decided after a move
+type Outcome struct {
+	Finished bool
+	Winner   int // -1 for a draw, when Finished
+	Next     int // player to move, when not Finished
+}
+
+var rulesByName = make(map[string]Rules)
+
+// RegisterRules makes a variant available under r.Name(). It is meant to be
+// called from init functions.
+func RegisterRules(r Rules) {
+	rulesByName[r.Name()] = r
+}
+
+func init() {
+	RegisterRules(Standard)
+	RegisterRules(PopOut)
+	RegisterRules(FiveInARow)
+	RegisterRules(PopTen)
+	RegisterRules(Cylinder)
+}
+
+// LookupRules returns the rules of a variant. An empty name selects
+// Standard.
+func LookupRules(variant string) (Rules, bool) {
+	if variant == "" {
+		return Standard, true
+	}
+	r, ok := rulesByName[variant]
+	return r, ok
+}
+
+// Variants lists the registered variants in alphabetical order.
+func Variants() []string {
+	names := make([]string, 0, len(rulesByName))
+	for name := range rulesByName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseVariantSize is ParseSize for a variant: zero values fall back to the
+// variant's default size, and the result must suit the variant.
+func ParseVariantSize(variant string, rows, columns, connect int) (Size, error) {
+	r, ok := LookupRules(variant)
+	if !ok {
+		return Size{}, &GameError{"unknown variant: " + variant}
+	}
+	size := r.DefaultSize()
+	if rows != 0 {
+		size.Rows = rows
+	}
+	if columns != 0 {
+		size.Columns = columns
+	}
+	if connect != 0 {
+		size.Connect = connect
+	}
+	return size, r.CheckSize(size)
+}
+
+// wraps reports whether g's board joins its left and right edges
+func (g *Game) wraps() bool {
+	r, ok := g.Rules().(*ConnectRules)
+	return ok && r.Wrap
+}
+
+// Rules returns the rules g is played by. Unknown variants, which
+// ParseVariant never lets through, fall back to Standard.
+func (g *Game) Rules() Rules {
+	if r, ok := LookupRules(g.Settings.Variant); ok {
+		return r
+	}
+	return Standard
+}
+
+// LegalActions lists the moves open to the current player of a game in
+// progress.
+func (g *Game) LegalActions() []Action {
+	if g.Status != "playing" {
+		return nil
+	}
+	return g.Rules().LegalMoves(g)
+}
+
+// repetitions counts how often the position after the last move, with next
+// to move, has occurred, this time included.
+func (g *Game) repetitions(next int) int {
+	hash := g.Hash
+	if next != g.CurrentPlayer {
+		hash ^= zobristSide
+	}
+	count := 1
+	if HashBoard(g.Start.Board, g.Start.Player) == hash {
+		count++
+	}
+	for _, h := range g.positions {
+		if h == hash {
+			count++
+		}
+	}
+	return count
+}
+
+// hasLine reports whether disc has a winning line anywhere on the board
+func (g *Game) hasLine(disc int) bool {
+	for row := 0; row < g.Size.Rows; row++ {
+		for col := 0; col < g.Size.Columns; col++ {
+			if g.Board[row][col] == disc && g.CheckWin(row, col) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setCell puts disc (0 to empty it) at row, column and updates the hash
+func (g *Game) setCell(row, column, disc int) {
+	if old := g.Board[row][column]; old != 0 {
+		g.Hash ^= ZobristKey(row, column, old)
+	}
+	if disc != 0 {
+		g.Hash ^= ZobristKey(row, column, disc)
+	}
+	g.Board[row][column] = disc
+}
+
+// dropRow returns the row a disc dropped into column lands in, or -1 if the
+// column is full.
+func (g *Game) dropRow(column int) int {
+	for row := g.Size.Rows - 1; row >= 0; row-- {
+		if g.Board[row][column] == 0 {
+			return row
+		}
+	}
+	return -1
+}
+
+// popColumn takes the bottom disc out of column and moves the rest down a
+// row.
+func (g *Game) popColumn(column int) {
+	for row := g.Size.Rows - 1; row > 0; row-- {
+		g.setCell(row, column, g.Board[row-1][column])
+	}
+	g.setCell(0, column, 0)
+}
@@ -0,0 +1,107 @@
+package game
+
+import "fmt"
+
+// Size is the shape of a board and the length of line that wins on it
+type Size struct {
+	Rows    int `json:"rows"`
+	Columns int `json:"columns"`
+	Connect int `json:"connect"` // discs in a row needed to win
+}
+
+// StandardSize is the classic board: 7 columns, 6 rows, four in a row
+var StandardSize = Size{Rows: 6, Columns: 7, Connect: 4}
+
+// Limits on board sizes. Columns stop at 9 so move notation keeps one digit
+// per move.
+const (
+	MinRows    = 4
+	MaxRows    = 10
+	MinColumns = 4
+	MaxColumns = 9
+	MinConnect = 3
+	MaxConnect = 6
+)
+
+// Validate checks s against the size limits and that a line of Connect discs
+// fits on the board.
+func (s Size) Validate() error {
+	if s.Rows < MinRows || s.Rows > MaxRows {
+		return &GameError{fmt.Sprintf("rows must be between %d and %d", MinRows, MaxRows)}
+	}
+	if s.Columns < MinColumns || s.Columns > MaxColumns {
+		return &GameError{fmt.Sprintf("columns must be between %d and %d", MinColumns, MaxColumns)}
+	}
+	if s.Connect < MinConnect || s.Connect > MaxConnect {
+		return &GameError{fmt.Sprintf("connect must be between %d and %d", MinConnect, MaxConnect)}
+	}
+	if s.Connect > s.Rows && s.Connect > s.Columns {
+		return &GameError{"connect is longer than the board"}
+	}
+	return nil
+}
+
+// Cells returns the number of cells on the board
+func (s Size) Cells() int {
+	return s.Rows * s.Columns
+}
+
+func (s Size) String() string {
+	return fmt.Sprintf("%dx%d connect %d", s.Columns, s.Rows, s.Connect)
+}
+
+// NewBoard returns an empty board of size s, top row first
+func NewBoard(s Size) [][]int {
+	board := make([][]int, s.Rows)
+	cells := make([]int, s.Cells())
+	for row := range board {
+		board[row] = cells[row*s.Columns : (row+1)*s.Columns : (row+1)*s.Columns]
+	}
+	return board
+}
+
+// CopyBoard returns a copy of board that shares nothing with it
+func CopyBoard(board [][]int) [][]int {
+	if len(board) == 0 {
+		return nil
+	}
+	copied := NewBoard(Size{Rows: len(board), Columns: len(board[0])})
+	for row := range board {
+		copy(copied[row], board[row])
+	}
+	return copied
+}
+
+// BoardsEqual reports whether a and b have the same shape and discs
+func BoardsEqual(a, b [][]int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for row := range a {
+		if len(a[row]) != len(b[row]) {
+			return false
+		}
+		for col := range a[row] {
+			if a[row][col] != b[row][col] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ParseSize validates a user supplied board size. Zero values fall back to
+// StandardSize.
+func ParseSize(rows, columns, connect int) (Size, error) {
+	size := StandardSize
+	if rows != 0 {
+		size.Rows = rows
+	}
+	if columns != 0 {
+		size.Columns = columns
+	}
+	if connect != 0 {
+		size.Connect = connect
+	}
+	return size, size.Validate()
+}
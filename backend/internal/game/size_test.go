@@ -0,0 +1,79 @@
+package game
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	for _, test := range []struct {
+		rows, columns, connect int
+		ok                     bool
+	}{
+		{0, 0, 0, true}, // the standard board
+		{MinRows, 0, 0, true},
+		{MinRows - 1, 0, 0, false},
+		{MaxRows, 0, 0, true},
+		{MaxRows + 1, 0, 0, false},
+		{0, MinColumns, 0, true},
+		{0, MinColumns - 1, 0, false},
+		{0, MaxColumns, 0, true},
+		{0, MaxColumns + 1, 0, false},
+		{0, 0, MinConnect, true},
+		{0, 0, MinConnect - 1, false},
+		{0, 0, MaxConnect, true},
+		{0, 0, MaxConnect + 1, false},
+		{4, 4, 5, false}, // no line of five fits
+		{5, 4, 5, true},  // only a vertical line of five fits
+		{7, 8, 5, true},
+	} {
+		size, err := ParseSize(test.rows, test.columns, test.connect)
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("ParseSize(%d, %d, %d): %v, want ok %t", test.rows, test.columns, test.connect, err, test.ok)
+			continue
+		}
+		if test.rows == 0 && test.columns == 0 && test.connect == 0 && size != StandardSize {
+			t.Errorf("ParseSize(0, 0, 0) = %s, want %s", size, StandardSize)
+		}
+	}
+}
+
+func TestLargeBoard(t *testing.T) {
+	size := Size{Rows: 7, Columns: 8, Connect: 5}
+	g := NewGameWithSize("test", Player{ID: "a"}, size)
+	if len(g.Board) != size.Rows || len(g.Board[0]) != size.Columns {
+		t.Fatalf("board is %dx%d, want %s", len(g.Board[0]), len(g.Board), size)
+	}
+	g.AddPlayer(Player{ID: "b"})
+	if _, _, err := g.Play(Drop(size.Columns)); err == nil {
+		t.Error("dropped a disc off the right of the board")
+	}
+	if _, row, err := g.Play(Drop(size.Columns - 1)); err != nil || row != size.Rows-1 {
+		t.Errorf("drop into the last column: row %d, %v", row, err)
+	}
+
+	const empty = "8/8/8/8/8/8/8 x standard 5"
+
+	// Four in a row is not enough, five is
+	g = playGame(t, empty, "1122334")
+	if g.Status != "playing" {
+		t.Errorf("%s after four in a row", g.Status)
+	}
+	g = playGame(t, empty, "112233445")
+	if g.Status != "finished" || g.Winner != 0 {
+		t.Errorf("%s with winner %d after five in a row, want x to win", g.Status, g.Winner)
+	}
+
+	// All seven rows of a column fill up
+	g = playGame(t, empty, "1111111")
+	if _, _, err := g.Play(Drop(0)); err == nil {
+		t.Error("dropped an eighth disc into a column")
+	}
+
+	// The last of the 56 cells fills without a line of five
+	const moves = "81655464881746377666264772438417124221583155855273833123"
+	g = playGame(t, empty, moves[:len(moves)-1])
+	if g.Status != "playing" {
+		t.Fatalf("%s before the board is full", g.Status)
+	}
+	if _, _, err := g.Play(Drop(2)); err != nil || g.Status != "finished" || g.Winner != -1 {
+		t.Errorf("full board: %v, %s with winner %d, want a draw", err, g.Status, g.Winner)
+	}
+}
@@ -0,0 +1,70 @@
+package game
+
+import "math/rand"
+
+// Zobrist hashing: every (cell, disc) pair gets a random 64-bit key and a
+// board's hash is the XOR of the keys of its discs, so a move updates the
+// hash with a single XOR. The seed is fixed so hashes are stable across
+// processes and can be stored, e.g. in an opening book.
+var (
+	zobristCells [MaxRows][MaxColumns][2]uint64
+	zobristSide  uint64 // XORed in when the second seat (CurrentPlayer 1) is to move
+)
+
+func init() {
+	r := rand.New(rand.NewSource(0x0c4f0c4f))
+	// The standard board's keys come first, in their original order, so
+	// hashes stored before boards could change size stay valid
+	for row := 0; row < StandardSize.Rows; row++ {
+		for col := 0; col < StandardSize.Columns; col++ {
+			zobristCells[row][col][0] = r.Uint64()
+			zobristCells[row][col][1] = r.Uint64()
+		}
+	}
+	zobristSide = r.Uint64()
+	for row := 0; row < MaxRows; row++ {
+		for col := 0; col < MaxColumns; col++ {
+			if row < StandardSize.Rows && col < StandardSize.Columns {
+				continue
+			}
+			zobristCells[row][col][0] = r.Uint64()
+			zobristCells[row][col][1] = r.Uint64()
+		}
+	}
+}
+
+// ZobristKey returns the key for disc (1 or 2) at row, col.
+func ZobristKey(row, col, disc int) uint64 {
+	return zobristCells[row][col][disc-1]
+}
+
+// ZobristSide returns the key toggled whenever the side to move changes.
+func ZobristSide() uint64 {
+	return zobristSide
+}
+
+// HashBoard computes the Zobrist hash of a board with currentPlayer to move.
+// The board's size and the variant are not part of the hash: a game's hash is
+// only compared with positions from the same game, such as when counting
+// repetitions or checking a bot's snapshot is still current. Anything that
+// keeps hashes from games of different sizes or rules side by side, like a
+// bot's transposition table, must mix those in itself.
+func HashBoard(board [][]int, currentPlayer int) uint64 {
+	var hash uint64
+	for row := range board {
+		for col, disc := range board[row] {
+			if disc != 0 {
+				hash ^= ZobristKey(row, col, disc)
+			}
+		}
+	}
+	if currentPlayer == 1 {
+		hash ^= zobristSide
+	}
+	return hash
+}
+
+// ComputeHash recomputes g's hash from scratch.
+func (g *Game) ComputeHash() uint64 {
+	return HashBoard(g.Board, g.CurrentPlayer)
+}
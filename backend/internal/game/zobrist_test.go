@@ -0,0 +1,55 @@
+package game
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// TestIncrementalHash plays random games in every variant and checks that the
+// hash Play keeps up to date always matches one computed from scratch.
+func TestIncrementalHash(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, test := range []struct {
+		variant string
+		size    Size
+	}{
+		{VariantStandard, StandardSize},
+		{VariantStandard, Size{Rows: 7, Columns: 8, Connect: 5}},
+		{VariantPopOut, StandardSize},
+		{VariantPopTen, StandardSize},
+		{VariantFiveInARow, FiveInARow.DefaultSize()},
+		{VariantCylinder, StandardSize},
+	} {
+		var pops, kept int
+		for round := 0; round < 20; round++ {
+			g := NewGameWithSettings("hash", Player{ID: "a"}, Settings{Variant: test.variant}, test.size)
+			g.AddPlayer(Player{ID: "b"})
+			for moves := 0; g.Status == "playing" && moves < 200; moves++ {
+				actions := g.LegalActions()
+				a := actions[rng.Intn(len(actions))]
+				if _, _, err := g.Play(a); err != nil {
+					t.Fatalf("%s: %s: %v", test.variant, a, err)
+				}
+				if g.Hash != g.ComputeHash() {
+					t.Fatalf("%s %s: hash %x after %s, computed %x", test.variant, test.size, g.Hash, FormatMoves(g.Moves), g.ComputeHash())
+				}
+				if a.Kind == KindPop {
+					pops++
+					if g.Moves[len(g.Moves)-1].Kept {
+						kept++
+					}
+				}
+			}
+		}
+		switch test.variant {
+		case VariantPopOut:
+			if pops == 0 {
+				t.Errorf("%s: no pops were played", test.variant)
+			}
+		case VariantPopTen:
+			if kept == 0 {
+				t.Errorf("%s: no discs were kept", test.variant)
+			}
+		}
+	}
+}
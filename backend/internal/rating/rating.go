@@ -0,0 +1,135 @@
+package rating
+
+import (
+	"connect-four/internal/bot"
+	"connect-four/internal/game"
+	"log"
+	"math"
+	"sync"
+)
+
+const (
+	// Default is the rating of a player who hasn't finished a rated game
+	Default = 1200
+	// K is the most one game can move a rating
+	K = 32
+)
+
+// ErrNotFound is returned for players who have no rating yet
+var ErrNotFound = &RatingError{"rating not found"}
+
+// Store keeps players' ratings by username
+type Store interface {
+	GetRating(username string) (int, error)
+	SaveRating(username string, rating int) error
+}
+
+// Expected returns the score a player rated a can expect against one rated
+// b: 1 for a certain win, 0.5 for an even game.
+func Expected(a, b int) float64 {
+	return 1 / (1 + math.Pow(10, float64(b-a)/400))
+}
+
+// Update returns a's rating after scoring score against b: 1 for a win, 0.5
+// for a draw and 0 for a loss.
+func Update(a, b int, score float64) int {
+	return a + int(math.Round(K*(score-Expected(a, b))))
+}
+
+// Ratings maintains Elo ratings from finished rated games. Bots aren't
+// rated themselves: they play at their difficulty tier's rating.
+type Ratings struct {
+	store Store
+	mu    sync.Mutex // updates read and write both players' ratings
+}
+
+func New(store Store) *Ratings {
+	return &Ratings{store: store}
+}
+
+// Get returns a player's rating, Default for players without one.
+func (r *Ratings) Get(username string) int {
+	rating, err := r.store.GetRating(username)
+	if err != nil {
+		if err != ErrNotFound {
+			log.Printf("Error reading rating of %s: %v", username, err)
+		}
+		return Default
+	}
+	return rating
+}
+
+// RecordGame updates the ratings of the human players of a finished rated
+// game. Other games are ignored.
+func (r *Ratings) RecordGame(g *game.Game) error {
+	if g.Status != "finished" || g.Settings.Mode != game.ModeRated {
+		return nil
+	}
+	if g.Players[0].IsBot && g.Players[1].IsBot {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ratings [2]int
+	for seat, p := range g.Players {
+		if p.IsBot {
+			ratings[seat] = bot.Difficulty(p.BotLevel).Level().Rating
+		} else {
+			ratings[seat] = r.Get(p.Username)
+		}
+	}
+
+	for seat, p := range g.Players {
+		if p.IsBot {
+			continue
+		}
+		score := 0.5
+		if g.Winner == seat {
+			score = 1
+		} else if g.Winner == 1-seat {
+			score = 0
+		}
+		rating := Update(ratings[seat], ratings[1-seat], score)
+		if err := r.store.SaveRating(p.Username, rating); err != nil {
+			return err
+		}
+		log.Printf("Rating of %s: %d -> %d", p.Username, ratings[seat], rating)
+	}
+	return nil
+}
+
+// MemoryStore keeps ratings in memory, for running without a database.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	ratings map[string]int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{ratings: make(map[string]int)}
+}
+
+func (s *MemoryStore) GetRating(username string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if rating, ok := s.ratings[username]; ok {
+		return rating, nil
+	}
+	return 0, ErrNotFound
+}
+
+func (s *MemoryStore) SaveRating(username string, rating int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ratings[username] = rating
+	return nil
+}
+
+type RatingError struct {
+	Message string
+}
+
+func (e *RatingError) Error() string {
+	return e.Message
+}
@@ -0,0 +1,155 @@
+// Package review annotates finished games move by move so players can see
+// where they went wrong.
+package review
+
+import (
+	"connect-four/internal/bot"
+	"connect-four/internal/game"
+	"connect-four/internal/solver"
+	"context"
+	"time"
+)
+
+// Label grades a move by how much worse it was than the bot's choice
+type Label string
+
+const (
+	Best       Label = "best"
+	Good       Label = "good"
+	Inaccuracy Label = "inaccuracy"
+	Mistake    Label = "mistake"
+	Blunder    Label = "blunder"
+)
+
+// Evaluation swings, in bot search score units, above which a move gets a
+// worse label. A three-in-a-row is worth about 5.
+const (
+	goodSwing       = 4
+	inaccuracySwing = 10
+	mistakeSwing    = 25
+)
+
+// MoveReview describes one move of a reviewed game. Scores are from the
+// point of view of the player who moved.
+type MoveReview struct {
+	Ply        int            `json:"ply"`    // 1-based
+	Player     int            `json:"player"` // 0 or 1
+	Column     int            `json:"column"`
+	Label      Label          `json:"label"`
+	Score      int            `json:"score"`
+	Outcome    solver.Outcome `json:"outcome,omitempty"` // forced result of the move played, if known
+	BestColumn int            `json:"bestColumn"`
+	BestScore  int            `json:"bestScore"`
+	BestLine   []int          `json:"bestLine"`
+	MissedWin  bool           `json:"missedWin,omitempty"` // a forced win was available but not played
+}
+
+// Review is the annotated record of a finished game
+type Review struct {
+	GameID    string           `json:"gameId"`
+	Moves     []MoveReview     `json:"moves"`
+	Summary   [2]map[Label]int `json:"summary"` // label counts per player
+	CreatedAt time.Time        `json:"createdAt"`
+}
+
+// Job is a finished game waiting to be reviewed: its starting position and
+// the columns played from there.
+type Job struct {
+	GameID string
+	Size   game.Size
+	Start  game.Start
+	Moves  []int
+}
+
+// Analyze replays the game in job, asking analyst for its opinion of every
+// position, and labels each move.
+func Analyze(ctx context.Context, analyst *bot.Bot, job Job) (*Review, error) {
+	g := game.NewGameWithSize(job.GameID, game.Player{ID: "player1"}, job.Size)
+	g.AddPlayer(game.Player{ID: "player2"})
+	g.SetPosition(job.Start.Board, job.Start.Player)
+
+	r := &Review{
+		GameID:    job.GameID,
+		Summary:   [2]map[Label]int{{}, {}},
+		CreatedAt: time.Now(),
+	}
+	for i, col := range job.Moves {
+		analysis, err := analyst.Analyze(ctx, g)
+		if err != nil {
+			return nil, err
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		move := reviewMove(analysis, col)
+		move.Ply = i + 1
+		move.Player = g.CurrentPlayer
+		r.Moves = append(r.Moves, move)
+		r.Summary[move.Player][move.Label]++
+
+		if _, _, err := g.MakeMove(col); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// reviewMove compares the column played with the best one in analysis
+func reviewMove(analysis *bot.Analysis, col int) MoveReview {
+	var played, best bot.ColumnEval
+	for _, c := range analysis.Columns {
+		if c.Column == col {
+			played = c
+		}
+		if c.Column == analysis.BestColumn {
+			best = c
+		}
+	}
+
+	move := MoveReview{
+		Column:     col,
+		Score:      played.Score,
+		Outcome:    played.Outcome,
+		BestColumn: best.Column,
+		BestScore:  best.Score,
+		BestLine:   analysis.BestLine,
+		MissedWin:  best.Outcome == solver.Win && played.Outcome != solver.Win,
+	}
+	move.Label = label(played, best)
+	return move
+}
+
+// label grades played against best. Throwing away a forced result outweighs
+// any evaluation swing.
+func label(played, best bot.ColumnEval) Label {
+	if played.Column == best.Column {
+		return Best
+	}
+
+	switch {
+	case best.Outcome == solver.Win && played.Outcome == solver.Win:
+		return Good // Slower, but still winning
+	case best.Outcome == solver.Win && played.Outcome == solver.Loss:
+		return Blunder
+	case best.Outcome == solver.Win:
+		return Mistake
+	case played.Outcome == solver.Loss && best.Outcome != solver.Loss:
+		return Blunder
+	case played.Outcome == solver.Loss:
+		return Good // Lost anyway, just sooner
+	}
+
+	swing := best.Score - played.Score
+	switch {
+	case swing <= 0:
+		return Best
+	case swing <= goodSwing:
+		return Good
+	case swing <= inaccuracySwing:
+		return Inaccuracy
+	case swing <= mistakeSwing:
+		return Mistake
+	}
+	return Blunder
+}
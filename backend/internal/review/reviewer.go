@@ -0,0 +1,141 @@
+package review
+
+import (
+	"connect-four/internal/bot"
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned for games that haven't been reviewed (yet)
+var ErrNotFound = &ReviewError{"review not found"}
+
+// Store keeps finished reviews
+type Store interface {
+	SaveReview(r *Review) error
+	GetReview(gameID string) (*Review, error)
+}
+
+// Reviewer analyses finished games in the background with a fixed number of
+// workers. Submit never blocks: when the queue is full the game is skipped.
+type Reviewer struct {
+	// Difficulty sets how long the analyst thinks about each position
+	Difficulty bot.Difficulty
+	// OnDone, if set, is called from a worker after each review is stored
+	OnDone func(r *Review)
+
+	store   Store
+	workers int
+	jobs    chan Job
+}
+
+func NewReviewer(store Store, workers, queueSize int) *Reviewer {
+	return &Reviewer{
+		Difficulty: bot.Hard,
+		store:      store,
+		workers:    workers,
+		jobs:       make(chan Job, queueSize),
+	}
+}
+
+// Run starts the workers and blocks until ctx is done. Reviews in progress
+// are abandoned.
+func (r *Reviewer) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < r.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Each worker keeps its analyst, and with it its transposition table
+			analyst := bot.NewBotWithDifficulty(r.Difficulty)
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-r.jobs:
+					r.review(ctx, analyst, job)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Submit queues a finished game and reports whether there was room for it
+func (r *Reviewer) Submit(job Job) bool {
+	select {
+	case r.jobs <- job:
+		return true
+	default:
+		log.Printf("Review queue full, skipping game %s", job.GameID)
+		return false
+	}
+}
+
+// Get returns the stored review of a game, or ErrNotFound
+func (r *Reviewer) Get(gameID string) (*Review, error) {
+	return r.store.GetReview(gameID)
+}
+
+func (r *Reviewer) review(ctx context.Context, analyst *bot.Bot, job Job) {
+	start := time.Now()
+	result, err := Analyze(ctx, analyst, job)
+	if err != nil {
+		log.Printf("Error reviewing game %s: %v", job.GameID, err)
+		return
+	}
+	if err := r.store.SaveReview(result); err != nil {
+		log.Printf("Error saving review of game %s: %v", job.GameID, err)
+		return
+	}
+	log.Printf("Reviewed game %s (%d moves) in %s", job.GameID, len(job.Moves), time.Since(start).Round(time.Millisecond))
+	if r.OnDone != nil {
+		r.OnDone(result)
+	}
+}
+
+// MemoryStore keeps the most recent reviews in memory, for running without a
+// database.
+type MemoryStore struct {
+	Limit int
+
+	mu      sync.RWMutex
+	reviews map[string]*Review
+	order   []string // oldest first
+}
+
+func NewMemoryStore(limit int) *MemoryStore {
+	return &MemoryStore{Limit: limit, reviews: make(map[string]*Review)}
+}
+
+func (s *MemoryStore) SaveReview(r *Review) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.reviews[r.GameID]; !exists {
+		s.order = append(s.order, r.GameID)
+	}
+	s.reviews[r.GameID] = r
+	for s.Limit > 0 && len(s.order) > s.Limit {
+		delete(s.reviews, s.order[0])
+		s.order = s.order[1:]
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetReview(gameID string) (*Review, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if r, ok := s.reviews[gameID]; ok {
+		return r, nil
+	}
+	return nil, ErrNotFound
+}
+
+type ReviewError struct {
+	Message string
+}
+
+func (e *ReviewError) Error() string {
+	return e.Message
+}
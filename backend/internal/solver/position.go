@@ -0,0 +1,256 @@
+package solver
+
+import (
+	"connect-four/internal/game"
+	"math/bits"
+)
+
+const (
+	Width  = 7
+	Height = 6
+
+	// MinScore and MaxScore bound the score of any position: the fastest
+	// possible win is with a player's 4th disc.
+	MinScore = -(Width*Height)/2 + 3
+	MaxScore = (Width*Height+1)/2 - 3
+)
+
+// Each column uses Height+1 bits: one per cell plus a sentinel bit on top
+// that keeps horizontal and diagonal shifts from wrapping into the next
+// column. Bit (col*(Height+1) + row) is the cell at row counted from the
+// bottom.
+var (
+	bottomMask = computeBottomMask()
+	boardMask  = bottomMask * ((1 << Height) - 1)
+)
+
+func computeBottomMask() uint64 {
+	var mask uint64
+	for col := 0; col < Width; col++ {
+		mask |= 1 << (col * (Height + 1))
+	}
+	return mask
+}
+
+func topMaskCol(col int) uint64 {
+	return 1 << (Height - 1 + col*(Height+1))
+}
+
+func bottomMaskCol(col int) uint64 {
+	return 1 << (col * (Height + 1))
+}
+
+func columnMask(col int) uint64 {
+	return ((1 << Height) - 1) << (col * (Height + 1))
+}
+
+// Position is a Connect Four position stored as two bitboards. current holds
+// the discs of the side to move and mask holds every disc on the board, so
+// playing a move is two bitwise operations and win detection needs no loops.
+type Position struct {
+	current uint64
+	mask    uint64
+	moves   int
+	player  int // disc value (1 or 2) of the side to move, for game.Game conversion
+}
+
+// NewPosition returns the empty board with player 1 to move.
+func NewPosition() *Position {
+	return &Position{player: 1}
+}
+
+// FromGame converts the board of g into a Position with g's current player to
+// move. It returns an error if the board has floating discs or is already won,
+// or if g isn't a standard game on the standard board.
+func FromGame(g *game.Game) (*Position, error) {
+	if g.Size != game.StandardSize {
+		return nil, &SolverError{"only the standard board can be solved"}
+	}
+	if g.Variant() != game.VariantStandard {
+		return nil, &SolverError{"only the standard variant can be solved"}
+	}
+	p := &Position{player: g.CurrentPlayer + 1}
+	for col := 0; col < Width; col++ {
+		empty := false
+		for row := 0; row < Height; row++ {
+			cell := g.Board[Height-1-row][col]
+			if cell == 0 {
+				empty = true
+				continue
+			}
+			if empty {
+				return nil, &SolverError{"board has a floating disc"}
+			}
+			bit := uint64(1) << (col*(Height+1) + row)
+			p.mask |= bit
+			if cell == p.player {
+				p.current |= bit
+			}
+			p.moves++
+		}
+	}
+
+	if alignment(p.current) || alignment(p.current^p.mask) {
+		return nil, &SolverError{"position is already won"}
+	}
+	return p, nil
+}
+
+// PlaySequence plays a string of 1-based column digits such as "4453" and
+// returns the number of moves played before an invalid or winning move.
+func (p *Position) PlaySequence(seq string) int {
+	for i := 0; i < len(seq); i++ {
+		col := int(seq[i] - '1')
+		if col < 0 || col >= Width || !p.CanPlay(col) || p.IsWinningMove(col) {
+			return i
+		}
+		p.PlayCol(col)
+	}
+	return len(seq)
+}
+
+// ApplyTo makes the position g's starting position, clearing its history. g
+// must be a standard game.
+func (p *Position) ApplyTo(g *game.Game) {
+	g.SetPosition(p.Board(), p.player-1)
+}
+
+// Board returns the position in game.Game's row-major layout, row 0 on top.
+func (p *Position) Board() [][]int {
+	board := game.NewBoard(game.StandardSize)
+	opponent := 3 - p.player
+	for col := 0; col < Width; col++ {
+		for row := 0; row < Height; row++ {
+			bit := uint64(1) << (col*(Height+1) + row)
+			switch {
+			case p.current&bit != 0:
+				board[Height-1-row][col] = p.player
+			case p.mask&bit != 0:
+				board[Height-1-row][col] = opponent
+			}
+		}
+	}
+	return board
+}
+
+// Moves returns the number of discs on the board.
+func (p *Position) Moves() int {
+	return p.moves
+}
+
+// Key uniquely identifies the position (current+mask sets a bit above the
+// top disc of each column, so the sum can't collide).
+func (p *Position) Key() uint64 {
+	return p.current + p.mask
+}
+
+func (p *Position) CanPlay(col int) bool {
+	return p.mask&topMaskCol(col) == 0
+}
+
+// PlayCol drops a disc for the side to move. The caller must check CanPlay.
+func (p *Position) PlayCol(col int) {
+	p.play((p.mask + bottomMaskCol(col)) & columnMask(col))
+}
+
+func (p *Position) play(move uint64) {
+	p.current ^= p.mask
+	p.mask |= move
+	p.moves++
+	p.player = 3 - p.player
+}
+
+// IsWinningMove reports whether playing col wins immediately for the side to move.
+func (p *Position) IsWinningMove(col int) bool {
+	return p.winningPosition()&p.possible()&columnMask(col) != 0
+}
+
+// CanWinNext reports whether the side to move has an immediate win.
+func (p *Position) CanWinNext() bool {
+	return p.winningPosition()&p.possible() != 0
+}
+
+// possibleNonLosingMoves returns the playable cells that don't hand the
+// opponent an immediate win, or 0 if every move loses.
+func (p *Position) possibleNonLosingMoves() uint64 {
+	possible := p.possible()
+	opponentWin := p.opponentWinningPosition()
+	forced := possible & opponentWin
+	if forced != 0 {
+		if forced&(forced-1) != 0 {
+			return 0 // Opponent has two immediate threats
+		}
+		possible = forced
+	}
+	return possible &^ (opponentWin >> 1) // Avoid playing below an opponent threat
+}
+
+// moveScore counts the winning cells a move would create, for move ordering.
+func (p *Position) moveScore(move uint64) int {
+	return bits.OnesCount64(computeWinningPosition(p.current|move, p.mask))
+}
+
+func (p *Position) possible() uint64 {
+	return (p.mask + bottomMask) & boardMask
+}
+
+func (p *Position) winningPosition() uint64 {
+	return computeWinningPosition(p.current, p.mask)
+}
+
+func (p *Position) opponentWinningPosition() uint64 {
+	return computeWinningPosition(p.current^p.mask, p.mask)
+}
+
+// computeWinningPosition returns the empty cells that would complete a line of
+// four for the discs in position.
+func computeWinningPosition(position, mask uint64) uint64 {
+	// Vertical
+	r := (position << 1) & (position << 2) & (position << 3)
+
+	// Horizontal
+	p := (position << (Height + 1)) & (position << (2 * (Height + 1)))
+	r |= p & (position << (3 * (Height + 1)))
+	r |= p & (position >> (Height + 1))
+	p = (position >> (Height + 1)) & (position >> (2 * (Height + 1)))
+	r |= p & (position << (Height + 1))
+	r |= p & (position >> (3 * (Height + 1)))
+
+	// Diagonal (bottom-left to top-right)
+	p = (position << Height) & (position << (2 * Height))
+	r |= p & (position << (3 * Height))
+	r |= p & (position >> Height)
+	p = (position >> Height) & (position >> (2 * Height))
+	r |= p & (position << Height)
+	r |= p & (position >> (3 * Height))
+
+	// Diagonal (top-left to bottom-right)
+	p = (position << (Height + 2)) & (position << (2 * (Height + 2)))
+	r |= p & (position << (3 * (Height + 2)))
+	r |= p & (position >> (Height + 2))
+	p = (position >> (Height + 2)) & (position >> (2 * (Height + 2)))
+	r |= p & (position << (Height + 2))
+	r |= p & (position >> (3 * (Height + 2)))
+
+	return r & (boardMask ^ mask)
+}
+
+// alignment reports whether position contains four in a row.
+func alignment(position uint64) bool {
+	for _, shift := range [4]uint{1, Height, Height + 1, Height + 2} {
+		m := position & (position >> shift)
+		if m&(m>>(2*shift)) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Simple error type for solver package
+type SolverError struct {
+	Message string
+}
+
+func (e *SolverError) Error() string {
+	return e.Message
+}
@@ -0,0 +1,318 @@
+package solver
+
+import "context"
+
+// Outcome is the game-theoretic value of a position for the side to move.
+type Outcome string
+
+const (
+	Win  Outcome = "win"
+	Loss Outcome = "loss"
+	Draw Outcome = "draw"
+)
+
+// Result describes a solved position from the side to move's point of view.
+// Score is positive for a win: the earlier the win, the higher the score.
+// Distance is the number of plies until the game ends with perfect play.
+type Result struct {
+	Score    int     `json:"score"`
+	Outcome  Outcome `json:"outcome"`
+	Distance int     `json:"distance"`
+}
+
+// Center-first column exploration order
+var columnOrder = [Width]int{3, 2, 4, 1, 5, 0, 6}
+
+// Solver proves the value of positions with a null-window negamax search.
+// A Solver is not safe for concurrent use; its transposition table is reused
+// between calls so consecutive solves of related positions get faster.
+type Solver struct {
+	table   *transpositionTable
+	nodes   int64
+	ctx     context.Context // nil unless solving through a *Context method
+	aborted bool
+}
+
+func NewSolver() *Solver {
+	return NewSolverWithTableSize(DefaultTableSize)
+}
+
+// NewSolverWithTableSize creates a solver with a smaller or larger table.
+// size should be a prime of at least 2^17 for the key truncation to be exact.
+func NewSolverWithTableSize(size int) *Solver {
+	return &Solver{table: newTranspositionTable(size)}
+}
+
+// Nodes returns the number of positions explored since the last Reset.
+func (s *Solver) Nodes() int64 {
+	return s.nodes
+}
+
+// Reset clears the node counter and the transposition table.
+func (s *Solver) Reset() {
+	s.nodes = 0
+	s.table.reset()
+}
+
+// Solve returns the exact value of p.
+func (s *Solver) Solve(p *Position) Result {
+	return newResult(p, s.solveScore(p, false))
+}
+
+// WeakSolve only determines whether p is won, lost or drawn, which is much
+// faster than computing the exact distance. Distance is left at zero.
+func (s *Solver) WeakSolve(p *Position) Result {
+	score := s.solveScore(p, true)
+	switch {
+	case score > 0:
+		return Result{Score: score, Outcome: Win}
+	case score < 0:
+		return Result{Score: score, Outcome: Loss}
+	}
+	return Result{Outcome: Draw}
+}
+
+// ScoreMoves solves every column for the side to move. The returned slice is
+// indexed by column; ok[col] is false when the column is full.
+func (s *Solver) ScoreMoves(p *Position) (results [Width]Result, ok [Width]bool) {
+	for col := 0; col < Width; col++ {
+		if !p.CanPlay(col) {
+			continue
+		}
+		ok[col] = true
+		if p.IsWinningMove(col) {
+			results[col] = newResult(p, (Width*Height+1-p.moves)/2)
+			continue
+		}
+
+		child := *p
+		child.PlayCol(col)
+		if child.moves == Width*Height {
+			results[col] = Result{Outcome: Draw, Distance: 1}
+			continue
+		}
+		childResult := s.Solve(&child)
+		results[col] = newResult(p, -childResult.Score)
+	}
+	return results, ok
+}
+
+// ScoreMovesContext is ScoreMoves that gives up when ctx is done, returning
+// ctx's error.
+func (s *Solver) ScoreMovesContext(ctx context.Context, p *Position) ([Width]Result, [Width]bool, error) {
+	s.ctx = ctx
+	s.aborted = false
+	defer func() { s.ctx = nil }()
+
+	results, ok := s.ScoreMoves(p)
+	if s.aborted {
+		return [Width]Result{}, [Width]bool{}, ctx.Err()
+	}
+	return results, ok, nil
+}
+
+// BestMoveContext is BestMove that gives up when ctx is done, returning
+// ctx's error. Results proven before the deadline stay in the table.
+func (s *Solver) BestMoveContext(ctx context.Context, p *Position) (int, Result, error) {
+	s.ctx = ctx
+	s.aborted = false
+	defer func() { s.ctx = nil }()
+
+	col, result := s.BestMove(p)
+	if s.aborted {
+		return -1, Result{}, ctx.Err()
+	}
+	return col, result, nil
+}
+
+// BestMove returns the column with the best solved result for the side to
+// move, or -1 if the board is full.
+func (s *Solver) BestMove(p *Position) (int, Result) {
+	results, ok := s.ScoreMoves(p)
+	best := -1
+	for _, col := range columnOrder {
+		if ok[col] && (best == -1 || results[col].Score > results[best].Score) {
+			best = col
+		}
+	}
+	if best == -1 {
+		return -1, Result{Outcome: Draw}
+	}
+	return best, results[best]
+}
+
+func (s *Solver) solveScore(p *Position, weak bool) int {
+	if p.CanWinNext() {
+		return (Width*Height + 1 - p.moves) / 2
+	}
+
+	min := -(Width*Height - p.moves) / 2
+	max := (Width*Height + 1 - p.moves) / 2
+	if weak {
+		min, max = -1, 1
+	}
+
+	// Narrow the score window with null-window searches, probing near zero
+	// first since most positions are close to a draw.
+	for min < max && !s.aborted {
+		med := min + (max-min)/2
+		if med <= 0 && min/2 < med {
+			med = min / 2
+		} else if med >= 0 && max/2 > med {
+			med = max / 2
+		}
+		r := s.negamax(p, med, med+1)
+		if r <= med {
+			max = r
+		} else {
+			min = r
+		}
+	}
+	return min
+}
+
+// negamax returns the score of p if it lies in (alpha, beta), otherwise a
+// bound on it. The caller guarantees the side to move has no immediate win.
+func (s *Solver) negamax(p *Position, alpha, beta int) int {
+	s.nodes++
+	if s.ctx != nil && s.nodes&4095 == 0 {
+		select {
+		case <-s.ctx.Done():
+			s.aborted = true
+		default:
+		}
+	}
+	if s.aborted {
+		return 0 // Unwinds quickly; nothing is stored from here on
+	}
+
+	next := p.possibleNonLosingMoves()
+	if next == 0 {
+		return -(Width*Height - p.moves) / 2 // Every move lets the opponent win
+	}
+	if p.moves >= Width*Height-2 {
+		return 0 // Draw: neither side can win with the last two discs
+	}
+
+	// Lower bound: the opponent can't win before its next move
+	min := -(Width*Height - 2 - p.moves) / 2
+	if alpha < min {
+		alpha = min
+		if alpha >= beta {
+			return alpha
+		}
+	}
+
+	// Upper bound: we can't win with our next move
+	max := (Width*Height - 1 - p.moves) / 2
+	if val := int(s.table.get(p.Key())); val != 0 {
+		if val > MaxScore-MinScore+1 {
+			min = val + 2*MinScore - MaxScore - 2
+			if alpha < min {
+				alpha = min
+				if alpha >= beta {
+					return alpha
+				}
+			}
+		} else {
+			max = val + MinScore - 1
+			if beta > max {
+				beta = max
+				if alpha >= beta {
+					return beta
+				}
+			}
+		}
+	}
+	if beta > max {
+		beta = max
+		if alpha >= beta {
+			return beta
+		}
+	}
+
+	var moves moveSorter
+	for i := Width - 1; i >= 0; i-- {
+		if move := next & columnMask(columnOrder[i]); move != 0 {
+			moves.add(move, p.moveScore(move))
+		}
+	}
+
+	for move := moves.next(); move != 0; move = moves.next() {
+		child := *p
+		child.play(move)
+		score := -s.negamax(&child, -beta, -alpha)
+		if s.aborted {
+			return 0
+		}
+		if score >= beta {
+			s.table.put(p.Key(), uint8(score+MaxScore-2*MinScore+2)) // Lower bound
+			return score
+		}
+		if score > alpha {
+			alpha = score
+		}
+	}
+
+	s.table.put(p.Key(), uint8(alpha-MinScore+1)) // Upper bound
+	return alpha
+}
+
+// newResult converts a score for the side to move in p into a Result.
+func newResult(p *Position, score int) Result {
+	if score == 0 {
+		return Result{Outcome: Draw, Distance: Width*Height - p.moves}
+	}
+
+	// A win with score s is completed on move number 44-2s or 43-2s
+	// (1-based); the winner's parity decides which.
+	finalMove := 44 - 2*abs(score)
+	winnerParity := 1 // Side to move plays the odd plies from here
+	if score < 0 {
+		winnerParity = 0
+	}
+	if (finalMove-p.moves)%2 != winnerParity {
+		finalMove--
+	}
+
+	outcome := Win
+	if score < 0 {
+		outcome = Loss
+	}
+	return Result{Score: score, Outcome: outcome, Distance: finalMove - p.moves}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// moveSorter keeps up to Width moves ordered by score. Moves added later win
+// ties, which is why callers add them in reverse exploration order.
+type moveSorter struct {
+	size    int
+	entries [Width]struct {
+		move  uint64
+		score int
+	}
+}
+
+func (m *moveSorter) add(move uint64, score int) {
+	pos := m.size
+	m.size++
+	for ; pos > 0 && m.entries[pos-1].score > score; pos-- {
+		m.entries[pos] = m.entries[pos-1]
+	}
+	m.entries[pos].move = move
+	m.entries[pos].score = score
+}
+
+func (m *moveSorter) next() uint64 {
+	if m.size == 0 {
+		return 0
+	}
+	m.size--
+	return m.entries[m.size].move
+}
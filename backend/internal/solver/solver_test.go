@@ -0,0 +1,227 @@
+package solver
+
+import (
+	"connect-four/internal/game"
+	"flag"
+	"math/rand"
+	"testing"
+)
+
+// The empty board takes far longer to solve than the rest of the suite:
+//
+//	go test ./internal/solver -run EmptyBoard -solver.empty -timeout 0
+var solveEmpty = flag.Bool("solver.empty", false, "also prove the empty board is a first player win")
+
+type knownPosition struct {
+	sequence string
+	score    int
+}
+
+// End games from the test sets published with Pascal Pons' solver
+var endGames = []knownPosition{
+	{"2252576253462244111563365343671351441", -1},
+	{"7422341735647741166133573473242566", 1},
+	{"23163416124767223154467471272416755633", 0},
+}
+
+// Common openings after 5 to 12 plies. The first few take seconds each, so
+// only the benchmark solves them all.
+var openings = []knownPosition{
+	{"44344", 2},
+	{"73217546", 3},
+	{"52575425", 4},
+	{"17164347", 8},
+	{"2427531475", 3},
+	{"4711657471", 4},
+	{"761214645726", 3},
+}
+
+func play(t testing.TB, sequence string) *Position {
+	t.Helper()
+	p := NewPosition()
+	if n := p.PlaySequence(sequence); n != len(sequence) {
+		t.Fatalf("invalid sequence %q at move %d", sequence, n+1)
+	}
+	return p
+}
+
+func outcome(score int) Outcome {
+	switch {
+	case score > 0:
+		return Win
+	case score < 0:
+		return Loss
+	}
+	return Draw
+}
+
+func TestSolveKnownPositions(t *testing.T) {
+	s := NewSolver()
+	for _, kp := range append(endGames, openings[3:]...) {
+		p := play(t, kp.sequence)
+		if r := s.Solve(p); r.Score != kp.score || r.Outcome != outcome(kp.score) {
+			t.Errorf("%s: %+v, want score %d", kp.sequence, r, kp.score)
+		}
+		if r := s.WeakSolve(p); r.Outcome != outcome(kp.score) {
+			t.Errorf("%s: weak solve %s, want %s", kp.sequence, r.Outcome, outcome(kp.score))
+		}
+	}
+}
+
+func TestSolveEmptyBoard(t *testing.T) {
+	if !*solveEmpty {
+		t.Skip("run with -solver.empty")
+	}
+	if r := NewSolver().WeakSolve(NewPosition()); r.Outcome != Win {
+		t.Errorf("empty board is a %s for the first player, want a win", r.Outcome)
+	}
+}
+
+// refBoard is a plain board for checking the solver by exhaustive search
+type refBoard struct {
+	cells   [Height][Width]int // row 0 at the bottom
+	heights [Width]int
+	moves   int
+}
+
+func (b *refBoard) wins(col, disc int) bool {
+	row := b.heights[col]
+	for _, d := range [][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}} {
+		n := 1
+		for _, sign := range []int{1, -1} {
+			for r, c := row+sign*d[0], col+sign*d[1]; r >= 0 && r < Height && c >= 0 && c < Width && b.cells[r][c] == disc; r, c = r+sign*d[0], c+sign*d[1] {
+				n++
+			}
+		}
+		if n >= 4 {
+			return true
+		}
+	}
+	return false
+}
+
+// score is the solver's score of b for the side to move, found by trying
+// every line of play
+func (b *refBoard) score(alpha, beta int) int {
+	if b.moves == Width*Height {
+		return 0
+	}
+	disc := b.moves%2 + 1
+	for col := 0; col < Width; col++ {
+		if b.heights[col] < Height && b.wins(col, disc) {
+			return (Width*Height + 1 - b.moves) / 2
+		}
+	}
+	best := -Width * Height
+	for col := 0; col < Width; col++ {
+		if b.heights[col] == Height {
+			continue
+		}
+		b.cells[b.heights[col]][col] = disc
+		b.heights[col]++
+		b.moves++
+		score := -b.score(-beta, -alpha)
+		b.moves--
+		b.heights[col]--
+		b.cells[b.heights[col]][col] = 0
+		if score > best {
+			best = score
+		}
+		if best > alpha {
+			alpha = best
+		}
+		if alpha >= beta {
+			break
+		}
+	}
+	return best
+}
+
+// TestSolveMatchesExhaustiveSearch solves random late positions and checks
+// the scores against a plain search through every line of play.
+func TestSolveMatchesExhaustiveSearch(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	s := NewSolver()
+	for checked := 0; checked < 100; {
+		var b refBoard
+		p := NewPosition()
+		for p.Moves() < 30 {
+			col := rng.Intn(Width)
+			if !p.CanPlay(col) || p.IsWinningMove(col) {
+				if p.possibleNonLosingMoves() == 0 {
+					break
+				}
+				continue
+			}
+			b.cells[b.heights[col]][col] = p.Moves()%2 + 1
+			b.heights[col]++
+			b.moves++
+			p.PlayCol(col)
+		}
+		if p.Moves() < 30 || p.CanWinNext() {
+			continue
+		}
+		checked++
+
+		want := b.score(-Width*Height, Width*Height)
+		if r := s.Solve(p); r.Score != want {
+			t.Errorf("position after %d moves: score %d, want %d\n%v", p.Moves(), r.Score, want, p.Board())
+		}
+	}
+}
+
+func TestFromGame(t *testing.T) {
+	p := play(t, endGames[1].sequence)
+	g := game.NewGame("solver", game.Player{ID: "a"})
+	g.AddPlayer(game.Player{ID: "b"})
+	p.ApplyTo(g)
+
+	back, err := FromGame(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.Key() != p.Key() || back.Moves() != p.Moves() {
+		t.Errorf("position changed going through a game")
+	}
+	if !game.BoardsEqual(back.Board(), g.Board) {
+		t.Errorf("board %v, want %v", back.Board(), g.Board)
+	}
+	if want := p.Moves() % 2; g.CurrentPlayer != want {
+		t.Errorf("player %d to move after %d moves, want %d", g.CurrentPlayer, p.Moves(), want)
+	}
+
+	// The solver's answer doesn't depend on how the position got there
+	if a, b := NewSolver().Solve(p), NewSolver().Solve(back); a != b {
+		t.Errorf("solved %+v, then %+v after the round trip", a, b)
+	}
+
+	for col := 0; col < Width; col++ {
+		if g.Board[1][col] == 0 {
+			g.Board[0][col] = 1
+			if _, err := FromGame(g); err == nil {
+				t.Error("accepted a floating disc")
+			}
+			break
+		}
+	}
+	g = game.NewGameWithSize("solver", game.Player{ID: "a"}, game.Size{Rows: 7, Columns: 8, Connect: 4})
+	if _, err := FromGame(g); err == nil {
+		t.Error("accepted a 7x8 board")
+	}
+}
+
+func BenchmarkSolve(b *testing.B) {
+	positions := make([]*Position, len(openings))
+	for i, kp := range openings {
+		positions[i] = play(b, kp.sequence)
+	}
+	s := NewSolver()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, p := range positions {
+			s.Reset()
+			s.Solve(p)
+		}
+	}
+	b.ReportMetric(float64(s.Nodes()), "nodes/last")
+}
@@ -0,0 +1,46 @@
+package solver
+
+// DefaultTableSize is a prime just below 2^23 (about 40MB). A prime size lets
+// the table keep only the low 32 bits of each 49-bit key: key mod size and
+// key mod 2^32 together identify the key uniquely.
+const DefaultTableSize = 8388593
+
+// transpositionTable caches one score bound per position. Entries are simply
+// overwritten on collision, which is cheap and good enough for a solver that
+// revisits recent positions far more often than old ones.
+type transpositionTable struct {
+	keys   []uint32
+	values []uint8 // 0 means empty
+}
+
+func newTranspositionTable(size int) *transpositionTable {
+	return &transpositionTable{
+		keys:   make([]uint32, size),
+		values: make([]uint8, size),
+	}
+}
+
+func (t *transpositionTable) index(key uint64) int {
+	return int(key % uint64(len(t.keys)))
+}
+
+func (t *transpositionTable) put(key uint64, value uint8) {
+	i := t.index(key)
+	t.keys[i] = uint32(key)
+	t.values[i] = value
+}
+
+func (t *transpositionTable) get(key uint64) uint8 {
+	i := t.index(key)
+	if t.keys[i] == uint32(key) {
+		return t.values[i]
+	}
+	return 0
+}
+
+func (t *transpositionTable) reset() {
+	for i := range t.keys {
+		t.keys[i] = 0
+		t.values[i] = 0
+	}
+}
@@ -0,0 +1,236 @@
+package websockethub
+
+import (
+	"connect-four/internal/bot"
+	"connect-four/internal/game"
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestHub returns a running hub whose bots answer at once
+func newTestHub(t *testing.T) *Hub {
+	t.Helper()
+	h := NewHub()
+	h.BotMinDelay = 0
+	h.BotThinkTime = 200 * time.Millisecond
+	go h.Run()
+	t.Cleanup(h.Shutdown)
+	return h
+}
+
+// startGame adds a game that is already under way and lets its bot move
+func startGame(h *Hub, g *game.Game) {
+	h.Mutex.Lock()
+	h.Games[g.ID] = g
+	h.Mutex.Unlock()
+	go h.makeBotMove(g.ID)
+}
+
+// waitFinished waits for a game to end and returns a snapshot of it
+func waitFinished(t *testing.T, h *Hub, gameID string, timeout time.Duration) *game.Game {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		h.Mutex.RLock()
+		g := h.Games[gameID].Clone()
+		h.Mutex.RUnlock()
+		if g.Status == "finished" {
+			return g
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("game %s didn't finish within %s", gameID, timeout)
+	return nil
+}
+
+// discCounts returns the number of discs each seat has on the board
+func discCounts(g *game.Game) [2]int {
+	var counts [2]int
+	for _, row := range g.Board {
+		for _, disc := range row {
+			if disc != 0 {
+				counts[disc-1]++
+			}
+		}
+	}
+	return counts
+}
+
+// raceGame sets up a position where each side has three discs stacked in an
+// edge column, seat 0 in the first and seat 1 in the last, so whoever is to
+// move wins at once by completing their own column, and only there.
+func raceGame(g *game.Game, toMove int) {
+	board := game.CopyBoard(g.Board)
+	for row := 3; row < 6; row++ {
+		board[row][0] = 1
+		board[row][6] = 2
+	}
+	g.SetPosition(board, toMove)
+}
+
+func TestBotInSeatZero(t *testing.T) {
+	h := newTestHub(t)
+	g := game.NewGame("seat0", game.Player{})
+	if seat := g.AddBot(string(bot.Expert), ""); seat != 0 {
+		t.Fatalf("bot took seat %d, want 0", seat)
+	}
+	g.AddPlayer(game.Player{ID: "human", Username: "human"})
+	raceGame(g, 0)
+	startGame(h, g)
+
+	finished := waitFinished(t, h, g.ID, 5*time.Second)
+	if finished.Winner != 0 {
+		t.Errorf("winner %d, want the bot in seat 0", finished.Winner)
+	}
+	if disc := finished.Board[2][0]; disc != 1 {
+		t.Errorf("column 1 holds disc %d on top, want the bot's", disc)
+	}
+	if counts := discCounts(finished); counts != [2]int{4, 3} {
+		t.Errorf("discs %v, want [4 3]", counts)
+	}
+}
+
+func TestBotInSeatOne(t *testing.T) {
+	h := newTestHub(t)
+	g := game.NewGame("seat1", game.Player{ID: "human", Username: "human"})
+	if seat := g.AddBot(string(bot.Expert), ""); seat != 1 {
+		t.Fatalf("bot took seat %d, want 1", seat)
+	}
+	raceGame(g, 1)
+	startGame(h, g)
+
+	finished := waitFinished(t, h, g.ID, 5*time.Second)
+	if finished.Winner != 1 {
+		t.Errorf("winner %d, want the bot in seat 1", finished.Winner)
+	}
+	if disc := finished.Board[2][6]; disc != 2 {
+		t.Errorf("column 7 holds disc %d on top, want the bot's", disc)
+	}
+	if counts := discCounts(finished); counts != [2]int{3, 4} {
+		t.Errorf("discs %v, want [3 4]", counts)
+	}
+}
+
+func TestBotsWinTheirOwnRace(t *testing.T) {
+	for seat := 0; seat < 2; seat++ {
+		h := newTestHub(t)
+		g := game.NewGame("race", game.Player{})
+		g.AddBot(string(bot.Expert), "")
+		g.AddBot(string(bot.Expert), "alphabeta")
+		raceGame(g, seat)
+		startGame(h, g)
+
+		finished := waitFinished(t, h, g.ID, 5*time.Second)
+		want := [2]int{3, 3}
+		want[seat]++
+		if counts := discCounts(finished); finished.Winner != seat || counts != want {
+			t.Errorf("seat %d to move: winner %d with discs %v, want seat %d at once", seat, finished.Winner, counts, seat)
+		}
+	}
+}
+
+func TestBotMatch(t *testing.T) {
+	h := newTestHub(t)
+	h.BotThinkTime = 20 * time.Millisecond
+	levels := [2]string{string(bot.Easy), string(bot.Medium)}
+	engines := [2]string{"alphabeta", "mcts"}
+	g := h.CreateBotMatch(levels, engines, game.Settings{Mode: game.ModeCasual}, game.StandardSize)
+
+	finished := waitFinished(t, h, g.ID, 30*time.Second)
+	for seat, p := range finished.Players {
+		if !p.IsBot || p.BotLevel != levels[seat] {
+			t.Errorf("seat %d: %+v, want a %s bot", seat, p, levels[seat])
+		}
+	}
+	// The bots took turns, so neither has more than one disc over the other
+	counts := discCounts(finished)
+	if diff := counts[0] - counts[1]; diff < -1 || diff > 1 {
+		t.Errorf("discs %v, the bots didn't take turns", counts)
+	}
+}
+
+func TestScriptedBotMatch(t *testing.T) {
+	h := newTestHub(t)
+	g := game.NewGame("scripted", game.Player{})
+	g.AddBot(string(bot.Easy), "")
+	g.AddBot(string(bot.Easy), "")
+	first := g.CurrentPlayer
+	h.SetEngine(g.ID, 0, bot.NewScripted(0, 0, 0, 0))
+	h.SetEngine(g.ID, 1, bot.NewScripted(1, 1, 1, 1))
+	startGame(h, g)
+
+	// Each bot fills its own column, so whoever started wins
+	finished := waitFinished(t, h, g.ID, 5*time.Second)
+	if finished.Winner != first {
+		t.Errorf("winner %d, want seat %d who moved first", finished.Winner, first)
+	}
+	for row := range finished.Board {
+		for seat, col := range [2]int{0, 1} {
+			if disc := finished.Board[row][col]; disc != 0 && disc != seat+1 {
+				t.Errorf("column %d holds disc %d, want only seat %d's", col+1, disc, seat)
+			}
+		}
+	}
+}
+
+// TestCancelBotMatch stops a bot match's search while an earlier search for
+// the same game, already cancelled, is still winding down. Ending the earlier
+// search mustn't leave the newer one out of reach.
+func TestCancelBotMatch(t *testing.T) {
+	h := newTestHub(t)
+	g := game.NewGame("cancel", game.Player{})
+	g.AddBot(string(bot.Easy), "")
+	g.AddBot(string(bot.Easy), "")
+	g.SetPosition(game.NewBoard(g.Size), 0)
+
+	var searches [2]struct{ started, stopped chan struct{} }
+	for i := range searches {
+		searches[i].started = make(chan struct{})
+		searches[i].stopped = make(chan struct{})
+	}
+	var calls int32
+	h.SetEngine(g.ID, 0, bot.EngineFunc(func(ctx context.Context, g *game.Game, clock bot.Clock) (game.Action, error) {
+		call := atomic.AddInt32(&calls, 1)
+		search := searches[call-1]
+		close(search.started)
+		<-ctx.Done()
+		if call == 1 {
+			// Slow to notice: still busy when the next search starts
+			<-searches[1].started
+		}
+		close(search.stopped)
+		return game.Action{}, ctx.Err()
+	}))
+	cancel := func() {
+		h.Mutex.Lock()
+		h.cancelBot(g.ID)
+		h.Mutex.Unlock()
+	}
+	wait := func(c chan struct{}, what string) {
+		t.Helper()
+		select {
+		case <-c:
+		case <-time.After(5 * time.Second):
+			t.Fatal(what)
+		}
+	}
+
+	startGame(h, g)
+	wait(searches[0].started, "the bot never started searching")
+	cancel()
+	go h.makeBotMove(g.ID)
+	wait(searches[0].stopped, "the first search didn't stop")
+	// Give the first search time to finish cleaning up
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	wait(searches[1].stopped, "cancelling the game didn't stop the second search")
+	h.Mutex.RLock()
+	moves := len(h.Games[g.ID].Moves)
+	h.Mutex.RUnlock()
+	if moves != 0 {
+		t.Errorf("%d moves played by cancelled searches", moves)
+	}
+}
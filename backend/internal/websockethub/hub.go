@@ -3,9 +3,15 @@ package websockethub
 import (
 	"connect-four/internal/game"
 	"connect-four/internal/bot"
+	"connect-four/internal/rating"
+	"connect-four/internal/review"
+	"context"
 	"encoding/json"
+	"io"
 	"log"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -15,17 +21,84 @@ type Client struct {
 	Hub      *Hub
 	Conn     *websocket.Conn
 	Send     chan []byte
-	PlayerID string
-	GameID   string
+	PlayerID string // identifies the connection, and the seat it takes with join_game
+	Username string
+	GameID   string // the game whose room the client is in, see Watch
+
+	hints sync.WaitGroup // get_hint searches still to answer
+
+	// Guarded by Hub.Mutex
+	seatGame string // the game whose seat this connection holds, see AttachSeat
+	closed   bool   // the connection is gone and can't hold a seat
 }
 
 type Hub struct {
+	// Clients and rooms are only touched by the Run goroutine, never under
+	// Mutex: broadcasts are sent with Mutex held, so locking here would
+	// deadlock.
 	Clients    map[*Client]bool
 	Games      map[string]*game.Game
 	Register   chan *Client
 	Unregister chan *Client
-	Broadcast  chan Message
+	Broadcast  chan RoomMessage
 	Mutex      sync.RWMutex
+
+	// BotMinDelay is the least time a bot takes to answer, so its moves don't
+	// appear instantly. Thinking time counts towards it.
+	BotMinDelay time.Duration
+	// BotThinkTime caps every bot search; 0 leaves it to the bot's difficulty.
+	BotThinkTime time.Duration
+	// Engines resolves game.Settings.BotEngine names.
+	Engines *bot.Registry
+	// HintDifficulty is the strength of the bot answering hint requests.
+	HintDifficulty bot.Difficulty
+	// Reviewer, if set, analyses every finished game in the background.
+	Reviewer *review.Reviewer
+	// TakebackTimeout is how long an opponent has to answer a takeback.
+	TakebackTimeout time.Duration
+	// MatchTimeout is how long a player waits for an opponent before a bot
+	// is played instead.
+	MatchTimeout time.Duration
+	// RatingWindow is how far apart in rating two players may be to be
+	// matched; WindowGrowth widens it for every second spent waiting.
+	RatingWindow int
+	WindowGrowth int
+	// Ratings, if set, keeps players' ratings up to date from rated games.
+	Ratings *rating.Ratings
+	// GameStore, if set, keeps every finished game.
+	GameStore GameStore
+	// GracePeriod is how long a player who lost their connection to a game
+	// in progress has to come back before they forfeit.
+	GracePeriod time.Duration
+
+	rooms       map[string]map[*Client]bool // clients by GameID
+	roomChanges chan roomChange
+
+	ctx        context.Context
+	cancel     context.CancelFunc
+	botCancels map[string]*botSearch
+	engines    map[string][2]bot.Engine // per game and seat, kept across moves
+	analysts   sync.Pool                // *bot.Bot, reused for their tables
+	takebacks  map[string]*takeback     // pending requests by game
+	queues     map[string][]*queueEntry // players waiting for a match, by kind of game, oldest first
+	queued     map[*Client]*queueEntry  // clients looking for a match
+	hosts      map[string]*queueEntry   // waiting games, by ID
+	sessions   map[string]session       // seats by session token
+	tokens     map[string]string        // session tokens by seatKey
+	presence   map[string]int           // open connections by seatKey
+	absences   map[string]*absence      // players who left a game in progress, by seatKey
+}
+
+// GameStore keeps finished games, along with the leaderboards built from
+// their results
+type GameStore interface {
+	SaveGame(g *game.Game) error
+}
+
+// botSearch is a bot's search in progress. Each search has its own, so a
+// search that ends only clears its own entry in botCancels.
+type botSearch struct {
+	cancel context.CancelFunc
 }
 
 type Message struct {
@@ -33,53 +106,87 @@ type Message struct {
 	Content json.RawMessage `json:"content"`
 }
 
+// HintMessage answers a get_hint request
+type HintMessage struct {
+	GameID   string        `json:"gameId"`
+	Analysis *bot.Analysis `json:"analysis"`
+}
+
+// JoinedMessage tells a client which seat it took with join_game
+type JoinedMessage struct {
+	GameID       string `json:"gameId"`
+	PlayerID     string `json:"playerId"`
+	Seat         int    `json:"seat"`
+	SessionToken string `json:"sessionToken"` // reclaims the seat after a lost connection
+}
+
 type GameMessage struct {
 	GameID   string `json:"gameId"`
 	PlayerID string `json:"playerId"`
 	Column   int    `json:"column,omitempty"`
 	Username string `json:"username,omitempty"`
+	Accept   bool   `json:"accept,omitempty"` // answer to a takeback request
 }
 
 func NewHub() *Hub {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Hub{
-		Clients:    make(map[*Client]bool),
-		Games:      make(map[string]*game.Game),
-		Register:   make(chan *Client),
-		Unregister: make(chan *Client),
-		Broadcast:  make(chan Message),
+		Clients:         make(map[*Client]bool),
+		Games:           make(map[string]*game.Game),
+		Register:        make(chan *Client),
+		Unregister:      make(chan *Client),
+		Broadcast:       make(chan RoomMessage),
+		BotMinDelay:     1 * time.Second,
+		Engines:         bot.DefaultRegistry,
+		HintDifficulty:  bot.Expert,
+		TakebackTimeout: 15 * time.Second,
+		MatchTimeout:    10 * time.Second,
+		RatingWindow:    100,
+		WindowGrowth:    50,
+		GracePeriod:     30 * time.Second,
+		ctx:             ctx,
+		cancel:          cancel,
+		botCancels:      make(map[string]*botSearch),
+		engines:         make(map[string][2]bot.Engine),
+		takebacks:       make(map[string]*takeback),
+		queues:          make(map[string][]*queueEntry),
+		queued:          make(map[*Client]*queueEntry),
+		hosts:           make(map[string]*queueEntry),
+		sessions:        make(map[string]session),
+		tokens:          make(map[string]string),
+		presence:        make(map[string]int),
+		absences:        make(map[string]*absence),
+		rooms:           make(map[string]map[*Client]bool),
+		roomChanges:     make(chan roomChange),
 	}
 }
 
 func (h *Hub) Run() {
 	// Cleanup goroutine for abandoned games
 	go h.cleanupRoutine()
+	go h.matchmakingRoutine()
+
+	if h.Reviewer != nil {
+		h.Reviewer.OnDone = h.broadcastReview
+		go h.Reviewer.Run(h.ctx)
+	}
 
 	for {
 		select {
 		case client := <-h.Register:
-			h.Mutex.Lock()
 			h.Clients[client] = true
-			h.Mutex.Unlock()
+			h.enterRoom(client)
 
 		case client := <-h.Unregister:
-			h.Mutex.Lock()
 			if _, ok := h.Clients[client]; ok {
-				delete(h.Clients, client)
-				close(client.Send)
+				h.removeClient(client)
 			}
-			h.Mutex.Unlock()
+
+		case change := <-h.roomChanges:
+			h.changeRoom(change)
 
 		case message := <-h.Broadcast:
-			h.Mutex.RLock()
-			for client := range h.Clients {
-				select {
-				case client.Send <- h.formatMessage(message):
-				default:
-					close(client.Send)
-					delete(h.Clients, client)
-				}
-			}
-			h.Mutex.RUnlock()
+			h.sendToRoom(message)
 		}
 	}
 }
@@ -89,37 +196,88 @@ func (h *Hub) formatMessage(msg Message) []byte {
 	return jsonMsg
 }
 
-func (h *Hub) CreateGame(player1 game.Player) *game.Game {
+// CreateGame creates a game on a board of the given size, which must suit
+// the variant in settings, waiting for a second player.
+func (h *Hub) CreateGame(player1 game.Player, settings game.Settings, size game.Size) *game.Game {
+	return h.addGame(game.NewGameWithSettings(generateGameID(), player1, settings, size), settings, false)
+}
+
+// CreateGameFromPosition creates a game that starts from p instead of the
+// empty board. Its variant is p's.
+func (h *Hub) CreateGameFromPosition(player1 game.Player, settings game.Settings, p game.Position) (*game.Game, error) {
+	if p.Over() {
+		return nil, &GameError{"position is already decided"}
+	}
+	settings.Variant = p.Variant
+	return h.addGame(game.NewGameFromPosition(generateGameID(), player1, p), settings, true), nil
+}
+
+// addGame registers a game waiting for its second player and queues it for
+// matchmaking. Private games can only be joined by ID.
+func (h *Hub) addGame(newGame *game.Game, settings game.Settings, private bool) *game.Game {
+	creatorRating := rating.Default
+	if !private {
+		creatorRating = h.ratingOf(newGame.Players[0].Username)
+	}
+
 	h.Mutex.Lock()
 	defer h.Mutex.Unlock()
 
-	gameID := generateGameID()
-	newGame := game.NewGame(gameID, player1)
+	gameID := newGame.ID
+	newGame.Settings = settings
 	h.Games[gameID] = newGame
+	h.issueSessions(newGame)
 
 	log.Printf("New game created: %s, Status: %s", gameID, newGame.Status)
-	log.Printf("Player 1: %s (IsBot: %t)", player1.Username, player1.IsBot)
+	log.Printf("Player 1: %s (IsBot: %t)", newGame.Players[0].Username, newGame.Players[0].IsBot)
+
+	h.queueGame(newGame, private, creatorRating)
+
+	return newGame
+}
 
-	// Start bot timeout
-	go h.startBotTimeout(gameID)
+// CreateBotMatch starts a game between two bots for clients to watch. Each
+// bot has a difficulty tier and an engine; an empty engine uses the one in
+// settings.
+func (h *Hub) CreateBotMatch(levels [2]string, engines [2]string, settings game.Settings, size game.Size) *game.Game {
+	h.Mutex.Lock()
+	defer h.Mutex.Unlock()
+
+	gameID := generateGameID()
+	newGame := game.NewGameWithSettings(gameID, game.Player{}, settings, size)
+	for seat := 0; seat < 2; seat++ {
+		newGame.AddBot(levels[seat], engines[seat])
+	}
+	h.Games[gameID] = newGame
+
+	log.Printf("New bot match created: %s, %s vs %s", gameID, levels[0], levels[1])
+	h.broadcastGameUpdate(newGame)
+	go h.makeBotMove(gameID)
 
 	return newGame
 }
 
+// JoinGame seats player2 in a waiting game, which starts it. It fails with
+// ErrGameNotFound, ErrGameFull or ErrGameStarted.
 func (h *Hub) JoinGame(gameID string, player2 game.Player) (*game.Game, error) {
 	h.Mutex.Lock()
 	defer h.Mutex.Unlock()
 
 	game, exists := h.Games[gameID]
 	if !exists {
-		return nil, &GameError{"game not found"}
+		return nil, ErrGameNotFound
 	}
 
+	if game.Players[0].ID != "" && game.Players[1].ID != "" {
+		return nil, ErrGameFull
+	}
 	if game.Status != "waiting" {
-		return nil, &GameError{"game already started"}
+		return nil, ErrGameStarted
 	}
 
 	game.AddPlayer(player2)
+	h.issueSessions(game)
+	h.unqueueGame(gameID)
 	h.broadcastGameUpdate(game)
 	
 	// If bot goes first after joining, trigger bot move
@@ -132,6 +290,11 @@ func (h *Hub) JoinGame(gameID string, player2 game.Player) (*game.Game, error) {
 }
 
 func (h *Hub) MakeMove(gameID string, playerID string, column int) (*game.Game, error) {
+	return h.Play(gameID, playerID, game.Drop(column))
+}
+
+// Play makes a move of either kind for playerID, e.g. a pop in PopOut games.
+func (h *Hub) Play(gameID string, playerID string, action game.Action) (*game.Game, error) {
 	h.Mutex.Lock()
 
 	game, exists := h.Games[gameID]
@@ -140,7 +303,7 @@ func (h *Hub) MakeMove(gameID string, playerID string, column int) (*game.Game,
 		return nil, &GameError{"game not found"}
 	}
 
-	log.Printf("MakeMove called - Game: %s, Player: %s, Column: %d", gameID, playerID, column)
+	log.Printf("Play called - Game: %s, Player: %s, Move: %s", gameID, playerID, action)
 
 	// Check if it's player's turn
 	currentPlayer := game.GetCurrentPlayer()
@@ -150,136 +313,342 @@ func (h *Hub) MakeMove(gameID string, playerID string, column int) (*game.Game,
 		return nil, &GameError{"not your turn"}
 	}
 
-	success, _, err := game.MakeMove(column)
-	if err != nil {
+	if err := h.applyMove(game, action); err != nil {
 		h.Mutex.Unlock()
 		log.Printf("Move error: %v", err)
 		return nil, err
 	}
 
-	log.Printf("Move successful: %t, Game status: %s", success, game.Status)
+	log.Printf("Move successful, Game status: %s", game.Status)
+	h.withdrawTakeback(gameID, "a move was played")
 
-	if success {
-		// Broadcast the move result
-		h.broadcastGameUpdate(game)
-		
-		// If bot's turn next, make bot move
-		if game.Status == "playing" {
-			nextPlayer := game.GetCurrentPlayer()
-			log.Printf("Next player: %s (IsBot: %t)", nextPlayer.Username, nextPlayer.IsBot)
-			
-			if nextPlayer.IsBot {
-				log.Printf("Triggering bot move after player move...")
-				// Unlock mutex before starting bot goroutine
-				h.Mutex.Unlock()
-				go h.makeBotMove(gameID)
-				return game, nil // Return here since we unlocked
-			}
-		}
-	}
-
-	h.Mutex.Unlock()
-	return game, nil
-}
-
-func (h *Hub) startBotTimeout(gameID string) {
-	time.Sleep(10 * time.Second)
-
-	h.Mutex.Lock()
-	defer h.Mutex.Unlock()
+	// Broadcast the move result
+	h.broadcastGameUpdate(game)
 
-	game, exists := h.Games[gameID]
-	if !exists {
-		return
-	}
+	// If bot's turn next, make bot move
+	if game.Status == "playing" {
+		nextPlayer := game.GetCurrentPlayer()
+		log.Printf("Next player: %s (IsBot: %t)", nextPlayer.Username, nextPlayer.IsBot)
 
-	// Check if still waiting for player
-	if game.Status == "waiting" {
-		log.Printf("Bot timeout reached for game %s, adding bot...", gameID)
-		game.AddBot()
-		h.broadcastGameUpdate(game)
-		
-		// If bot goes first, trigger bot move immediately
-		if game.Status == "playing" && game.GetCurrentPlayer().IsBot {
-			log.Printf("Bot goes first, triggering bot move...")
+		if nextPlayer.IsBot {
+			log.Printf("Triggering bot move after player move...")
+			// Unlock mutex before starting bot goroutine
+			h.Mutex.Unlock()
 			go h.makeBotMove(gameID)
+			return game, nil // Return here since we unlocked
 		}
 	}
+
+	h.Mutex.Unlock()
+	return game, nil
 }
 
 func (h *Hub) makeBotMove(gameID string) {
-	time.Sleep(1 * time.Second) // Small delay for realism
-
 	h.Mutex.Lock()
-	defer h.Mutex.Unlock()
 
 	log.Printf("Bot move starting for game: %s", gameID)
 
 	game, exists := h.Games[gameID]
 	if !exists {
+		h.Mutex.Unlock()
 		log.Printf("Game not found for bot move: %s", gameID)
 		return
 	}
 
 	if game.Status != "playing" {
+		h.Mutex.Unlock()
 		log.Printf("Game not in playing state: %s", game.Status)
 		return
 	}
 
 	currentPlayer := game.GetCurrentPlayer()
 	if !currentPlayer.IsBot {
+		h.Mutex.Unlock()
 		log.Printf("Not bot's turn. Current player: %s", currentPlayer.Username)
 		return
 	}
 
+	engine, err := h.engineFor(game)
+	if err != nil {
+		h.Mutex.Unlock()
+		log.Printf("No bot engine for game %s: %v", gameID, err)
+		return
+	}
+
+	// Think on a snapshot without holding the lock, so other games (and this
+	// game's clients) aren't blocked while the bot searches.
+	snapshot := game.Clone()
+	ctx, cancel := context.WithCancel(h.ctx)
+	search := &botSearch{cancel: cancel}
+	h.botCancels[gameID] = search
+	h.Mutex.Unlock()
+
+	defer func() {
+		cancel()
+		h.Mutex.Lock()
+		// The next bot's search may already have taken our place
+		if h.botCancels[gameID] == search {
+			delete(h.botCancels, gameID)
+		}
+		h.Mutex.Unlock()
+	}()
+
+	start := time.Now()
 	log.Printf("Bot calculating move for game %s...", gameID)
-	bot := bot.NewBot()
-	column := bot.CalculateMove(game)
+	move, err := engine.ChooseMove(ctx, snapshot, bot.Clock{MoveTime: h.BotThinkTime})
+	if err != nil {
+		log.Printf("Bot engine error for game %s: %v", gameID, err)
+		move.Column = -1
+	}
 
-	if column != -1 {
-		log.Printf("Bot making move in column: %d", column)
-		_, _, err := game.MakeMove(column)
-		if err != nil {
+	// Don't answer faster than a human could read the board
+	if wait := h.BotMinDelay - time.Since(start); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+		}
+	}
+	if ctx.Err() != nil {
+		log.Printf("Bot move cancelled for game %s", gameID)
+		return
+	}
+
+	h.Mutex.Lock()
+	defer h.Mutex.Unlock()
+
+	game, exists = h.Games[gameID]
+	if !exists || game.Status != "playing" || game.Hash != snapshot.Hash {
+		log.Printf("Game %s changed while bot was thinking, discarding move", gameID)
+		return
+	}
+
+	if move.Column != -1 {
+		log.Printf("Bot making move %s after %s", move, time.Since(start).Round(time.Millisecond))
+		if b, ok := engine.(*bot.Bot); ok {
+			stats := b.TableStats()
+			log.Printf("Bot table hit rate %.2f, %d probes", stats.HitRate(), stats.Probes)
+		}
+		if err := h.applyMove(game, move); err != nil {
 			log.Printf("Bot move error: %v", err)
 			return
 		}
 		h.broadcastGameUpdate(game)
 		log.Printf("Bot move completed successfully")
-		
-		// If it's still bot's turn after move (shouldn't happen in normal game)
+
+		// In bot matches the other seat is a bot too
 		if game.Status == "playing" && game.GetCurrentPlayer().IsBot {
-			log.Printf("Bot gets another turn? Triggering again...")
+			log.Printf("Next player is a bot, triggering bot move...")
 			go h.makeBotMove(gameID)
 		}
 	} else {
 		log.Printf("Bot couldn't find a valid move")
 		// If bot can't find a move but it's still their turn, try center column as fallback
 		log.Printf("Trying fallback to center column...")
-		for col := 3; col >= 0 && col < 7; col = 3 + (3-col)*-1 { // Try center, then alternate sides
-			if col != 3 {
-				col = 3 - (col-3) // Alternate: 3, 2, 4, 1, 5, 0, 6
-			}
-			if h.isValidMove(game, col) {
-				log.Printf("Fallback: Bot making move in column: %d", col)
-				_, _, err := game.MakeMove(col)
-				if err != nil {
-					log.Printf("Fallback bot move error: %v", err)
-				} else {
-					h.broadcastGameUpdate(game)
-					log.Printf("Fallback bot move completed successfully")
-				}
-				return
+		if fallback, ok := h.fallbackMove(game); ok {
+			log.Printf("Fallback: Bot making move %s", fallback)
+			if err := h.applyMove(game, fallback); err != nil {
+				log.Printf("Fallback bot move error: %v", err)
+			} else {
+				h.broadcastGameUpdate(game)
+				log.Printf("Fallback bot move completed successfully")
 			}
+			return
 		}
 		log.Printf("No valid fallback moves found!")
 	}
 }
 
-func (h *Hub) isValidMove(g *game.Game, column int) bool {
-	if column < 0 || column >= 7 {
-		return false
+// applyMove makes a move for the side to move in g and wraps up the game if
+// the move ended it. Callers hold the lock.
+func (h *Hub) applyMove(g *game.Game, action game.Action) error {
+	if _, _, err := g.Play(action); err != nil {
+		return err
+	}
+
+	if g.Status == "finished" {
+		h.finishGame(g)
 	}
-	return g.Board[0][column] == 0
+	return nil
+}
+
+// finishGame releases a finished game's engine and pending takeback, saves
+// it, updates ratings and queues it for review. Callers hold the lock.
+func (h *Hub) finishGame(g *game.Game) {
+	h.dropEngine(g.ID)
+	h.clearTakeback(g.ID)
+	h.clearAbsences(g)
+	// A game whose history doesn't add up is still kept, but worth a look
+	if err := g.Verify(); err != nil {
+		log.Printf("Game %s doesn't match its move history: %v", g.ID, err)
+	}
+	if h.GameStore != nil {
+		// Stored in the background, off the hub's lock
+		finished := g.Clone()
+		go func() {
+			if err := h.GameStore.SaveGame(finished); err != nil {
+				log.Printf("Error saving game %s: %v", finished.ID, err)
+			}
+		}()
+	}
+	if h.Ratings != nil {
+		finished := g.Clone()
+		go func() {
+			if err := h.Ratings.RecordGame(finished); err != nil {
+				log.Printf("Error updating ratings for game %s: %v", finished.ID, err)
+			}
+		}()
+	}
+	// Reviews analyse drops on standard rules only
+	if h.Reviewer != nil && g.Variant() == game.VariantStandard {
+		job := review.Job{GameID: g.ID, Size: g.Size, Start: g.Start}
+		for _, m := range g.Moves {
+			job.Moves = append(job.Moves, m.Column)
+		}
+		h.Reviewer.Submit(job)
+	}
+}
+
+// Record returns the text record of a finished game
+func (h *Hub) Record(gameID string) (string, error) {
+	h.Mutex.RLock()
+	defer h.Mutex.RUnlock()
+
+	g, exists := h.Games[gameID]
+	if !exists {
+		return "", ErrGameNotFound
+	}
+	if g.Status != "finished" {
+		return "", &GameError{"game is not finished"}
+	}
+	return g.Record(), nil
+}
+
+// Hint analyses a game in progress for one of its players. Hints are refused
+// in rated games.
+func (h *Hub) Hint(ctx context.Context, gameID string, playerID string) (*bot.Analysis, error) {
+	h.Mutex.RLock()
+	g, exists := h.Games[gameID]
+	if !exists {
+		h.Mutex.RUnlock()
+		return nil, &GameError{"game not found"}
+	}
+	if !g.Settings.HintsAllowed() {
+		h.Mutex.RUnlock()
+		return nil, &GameError{"hints are not available in rated games"}
+	}
+	if g.Players[0].ID != playerID && g.Players[1].ID != playerID {
+		h.Mutex.RUnlock()
+		return nil, &GameError{"not a player in this game"}
+	}
+	if g.Status != "playing" {
+		h.Mutex.RUnlock()
+		return nil, &GameError{"game is not active"}
+	}
+	snapshot := g.Clone()
+	h.Mutex.RUnlock()
+
+	return h.Analyze(ctx, snapshot)
+}
+
+// Analyze evaluates an arbitrary position, which need not belong to a game
+// on this hub.
+func (h *Hub) Analyze(ctx context.Context, g *game.Game) (*bot.Analysis, error) {
+	analyst, ok := h.analysts.Get().(*bot.Bot)
+	if !ok || analyst.Difficulty != h.HintDifficulty {
+		analyst = bot.NewBotWithDifficulty(h.HintDifficulty)
+	}
+	defer h.analysts.Put(analyst)
+	return analyst.Analyze(ctx, g)
+}
+
+// engineFor returns the engine playing the seat to move in g, creating it on
+// that bot's first move so it can keep state (such as its transposition
+// table) for the rest of the game. Callers hold the lock.
+func (h *Hub) engineFor(g *game.Game) (bot.Engine, error) {
+	seat := g.CurrentPlayer
+	seats := h.engines[g.ID]
+	if seats[seat] != nil {
+		return seats[seat], nil
+	}
+
+	player := g.Players[seat]
+	name := player.BotEngine
+	if name == "" {
+		name = g.Settings.BotEngine
+	}
+	engine, err := h.Engines.New(name, bot.Difficulty(player.BotLevel))
+	if err != nil {
+		return nil, err
+	}
+	seats[seat] = engine
+	h.engines[g.ID] = seats
+	return engine, nil
+}
+
+// SetEngine makes the bot in one seat of a game use engine, e.g. a
+// bot.Scripted one in tests, instead of the one named in the game.
+func (h *Hub) SetEngine(gameID string, seat int, engine bot.Engine) {
+	h.Mutex.Lock()
+	defer h.Mutex.Unlock()
+	seats := h.engines[gameID]
+	closeEngine(seats[seat])
+	seats[seat] = engine
+	h.engines[gameID] = seats
+}
+
+// dropEngine forgets the game's engines. Callers hold the lock.
+func (h *Hub) dropEngine(gameID string) {
+	for _, engine := range h.engines[gameID] {
+		closeEngine(engine)
+	}
+	delete(h.engines, gameID)
+}
+
+// closeEngine shuts down engines that hold resources such as an external
+// process.
+func closeEngine(engine bot.Engine) {
+	if closer, ok := engine.(io.Closer); ok {
+		go closer.Close()
+	}
+}
+
+// cancelBot stops any search in progress for the game. Callers hold the lock.
+func (h *Hub) cancelBot(gameID string) {
+	if search, ok := h.botCancels[gameID]; ok {
+		search.cancel()
+		delete(h.botCancels, gameID)
+	}
+}
+
+// Shutdown stops all bot searches and background routines.
+func (h *Hub) Shutdown() {
+	h.cancel()
+}
+
+// fallbackMove picks a move without thinking: a drop into the most central
+// column that allows one, or failing that any legal move, such as a pop on a
+// full PopOut board.
+func (h *Hub) fallbackMove(g *game.Game) (game.Action, bool) {
+	columns := g.Size.Columns
+	for i := 0; i < columns; i++ { // Try center, then alternate sides
+		col := columns/2 + (i+1)/2*(1-2*(i%2)) // 3, 2, 4, 1, 5, 0, 6 on 7 columns
+		if h.isValidMove(g, game.Drop(col)) {
+			return game.Drop(col), true
+		}
+	}
+	if actions := g.LegalActions(); len(actions) > 0 {
+		return actions[0], true
+	}
+	return game.Action{}, false
+}
+
+func (h *Hub) isValidMove(g *game.Game, action game.Action) bool {
+	for _, legal := range g.LegalActions() {
+		if legal == action {
+			return true
+		}
+	}
+	return false
 }
 
 func (h *Hub) broadcastGameUpdate(g *game.Game) {
@@ -295,19 +664,44 @@ func (h *Hub) broadcastGameUpdate(g *game.Game) {
 	}
 
 	log.Printf("Broadcasting game update for game: %s", g.ID)
-	h.Broadcast <- message
+	h.Broadcast <- RoomMessage{GameID: g.ID, Message: message}
+}
+
+// broadcastReview announces a finished review to the game's clients
+func (h *Hub) broadcastReview(r *review.Review) {
+	content, err := json.Marshal(r)
+	if err != nil {
+		log.Printf("Error marshaling game review: %v", err)
+		return
+	}
+
+	select {
+	case h.Broadcast <- RoomMessage{GameID: r.GameID, Message: Message{Type: "game_review", Content: content}}:
+	case <-h.ctx.Done():
+	}
 }
 
 func (h *Hub) cleanupRoutine() {
 	ticker := time.NewTicker(1 * time.Minute)
 	defer ticker.Stop()
 
-	for range ticker.C {
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
 		h.Mutex.Lock()
 		for gameID, game := range h.Games {
 			// Remove games older than 1 hour
 			if time.Since(game.CreatedAt) > time.Hour {
 				log.Printf("Cleaning up old game: %s", gameID)
+				h.cancelBot(gameID)
+				h.dropEngine(gameID)
+				h.clearTakeback(gameID)
+				h.unqueueGame(gameID)
+				h.dropSessions(game)
 				delete(h.Games, gameID)
 			}
 		}
@@ -315,8 +709,12 @@ func (h *Hub) cleanupRoutine() {
 	}
 }
 
+// gameCounter keeps IDs of games created in the same second apart
+var gameCounter uint64
+
 func generateGameID() string {
-	return "game_" + time.Now().Format("20060102150405")
+	n := atomic.AddUint64(&gameCounter, 1)
+	return "game_" + time.Now().Format("20060102150405") + "_" + strconv.FormatUint(n, 10)
 }
 
 func (c *Client) WritePump() {
@@ -347,6 +745,9 @@ func (c *Client) WritePump() {
 
 func (c *Client) ReadPump() {
 	defer func() {
+		c.Hub.CancelMatch(c) // a disconnected client can't be matched
+		c.Hub.leaveSeat(c)
+		c.hints.Wait()
 		c.Hub.Unregister <- c
 		c.Conn.Close()
 	}()
@@ -359,42 +760,173 @@ func (c *Client) ReadPump() {
 			}
 			break
 		}
+		c.handleMessage(message)
+	}
+}
 
-		var msg Message
-		if err := json.Unmarshal(message, &msg); err != nil {
-			log.Printf("Error unmarshaling message: %v", err)
-			continue
-		}
+// handleMessage acts on one message from the client
+func (c *Client) handleMessage(message []byte) {
+	var msg Message
+	if err := json.Unmarshal(message, &msg); err != nil {
+		log.Printf("Error unmarshaling message: %v", err)
+		return
+	}
 
-		switch msg.Type {
-		case "make_move":
-			var moveMsg GameMessage
-			if err := json.Unmarshal(msg.Content, &moveMsg); err != nil {
-				log.Printf("Error unmarshaling move message: %v", err)
-				continue
-			}
+	switch msg.Type {
+	case "make_move", "pop_disc":
+		var moveMsg GameMessage
+		if err := json.Unmarshal(msg.Content, &moveMsg); err != nil {
+			log.Printf("Error unmarshaling move message: %v", err)
+			return
+		}
+		moveMsg.PlayerID = c.PlayerID // a connection only acts for its own player
+		
+		log.Printf("Received move message: GameID=%s, PlayerID=%s, Column=%d", 
+			moveMsg.GameID, moveMsg.PlayerID, moveMsg.Column)
 			
-			log.Printf("Received move message: GameID=%s, PlayerID=%s, Column=%d", 
-				moveMsg.GameID, moveMsg.PlayerID, moveMsg.Column)
-				
-			game, err := c.Hub.MakeMove(moveMsg.GameID, moveMsg.PlayerID, moveMsg.Column)
-			if err != nil {
-				log.Printf("Move error: %v", err)
-				// Send error back to client
-				errorMsg := Message{
-					Type: "error",
-					Content: json.RawMessage(`{"message":"` + err.Error() + `"}`),
-				}
-				c.Send <- c.Hub.formatMessage(errorMsg)
-			} else {
-				log.Printf("Move processed successfully for game: %s", game.ID)
-			}
-		default:
-			log.Printf("Unknown message type: %s", msg.Type)
+		action := game.Drop(moveMsg.Column)
+		if msg.Type == "pop_disc" {
+			action = game.Pop(moveMsg.Column)
+		}
+		game, err := c.Hub.Play(moveMsg.GameID, moveMsg.PlayerID, action)
+		if err != nil {
+			log.Printf("Move error: %v", err)
+			// Send error back to client
+			c.sendError(err)
+		} else {
+			log.Printf("Move processed successfully for game: %s", game.ID)
+		}
+	case "get_hint":
+		var hintMsg GameMessage
+		if err := json.Unmarshal(msg.Content, &hintMsg); err != nil {
+			log.Printf("Error unmarshaling hint message: %v", err)
+			return
+		}
+		// Searching takes a while, and the client's other messages shouldn't
+		// wait for it
+		c.hints.Add(1)
+		go c.sendHint(hintMsg.GameID)
+	case "takeback_request":
+		var takebackMsg GameMessage
+		if err := json.Unmarshal(msg.Content, &takebackMsg); err != nil {
+			log.Printf("Error unmarshaling takeback request: %v", err)
+			return
+		}
+		takebackMsg.PlayerID = c.PlayerID
+		if err := c.Hub.RequestTakeback(takebackMsg.GameID, takebackMsg.PlayerID); err != nil {
+			log.Printf("Takeback error: %v", err)
+			c.sendError(err)
+		}
+	case "takeback_response":
+		var takebackMsg GameMessage
+		if err := json.Unmarshal(msg.Content, &takebackMsg); err != nil {
+			log.Printf("Error unmarshaling takeback response: %v", err)
+			return
+		}
+		takebackMsg.PlayerID = c.PlayerID
+		if err := c.Hub.RespondTakeback(takebackMsg.GameID, takebackMsg.PlayerID, takebackMsg.Accept); err != nil {
+			log.Printf("Takeback error: %v", err)
+			c.sendError(err)
 		}
+	case "join_game":
+		var joinMsg GameMessage
+		if err := json.Unmarshal(msg.Content, &joinMsg); err != nil {
+			log.Printf("Error unmarshaling join message: %v", err)
+			return
+		}
+		if err := c.join(joinMsg.GameID, joinMsg.Username); err != nil {
+			log.Printf("Join error: %v", err)
+			c.sendError(err)
+		}
+	case "find_match":
+		var matchMsg MatchRequest
+		if err := json.Unmarshal(msg.Content, &matchMsg); err != nil {
+			log.Printf("Error unmarshaling match request: %v", err)
+			return
+		}
+		if err := c.Hub.FindMatch(c, matchMsg); err != nil {
+			log.Printf("Matchmaking error: %v", err)
+			c.sendError(err)
+		}
+	case "cancel_match":
+		if err := c.Hub.CancelMatch(c); err != nil {
+			c.sendError(err)
+			return
+		}
+		c.Send <- c.Hub.formatMessage(Message{Type: "match_cancelled", Content: json.RawMessage("{}")})
+	case "watch_game":
+		var watchMsg GameMessage
+		if err := json.Unmarshal(msg.Content, &watchMsg); err != nil {
+			log.Printf("Error unmarshaling watch message: %v", err)
+			return
+		}
+		if err := c.Hub.Watch(c, watchMsg.GameID); err != nil {
+			log.Printf("Watch error: %v", err)
+			c.sendError(err)
+		}
+	default:
+		log.Printf("Unknown message type: %s", msg.Type)
+	}
+}
+
+// sendHint answers a get_hint request. The search stops when the hub shuts
+// down; ReadPump waits for it before the client is unregistered, which closes
+// Send.
+func (c *Client) sendHint(gameID string) {
+	defer c.hints.Done()
+	analysis, err := c.Hub.Hint(c.Hub.ctx, gameID, c.PlayerID)
+	if err != nil {
+		log.Printf("Hint error: %v", err)
+		c.sendError(err)
+		return
+	}
+	content, _ := json.Marshal(HintMessage{GameID: gameID, Analysis: analysis})
+	c.Send <- c.Hub.formatMessage(Message{Type: "hint", Content: content})
+}
+
+// join takes the free seat of a waiting game for this connection: the seat's
+// player ID becomes the connection's and the connection moves to the game's
+// room. An empty username keeps the one the client connected with.
+func (c *Client) join(gameID, username string) error {
+	if username == "" {
+		username = c.Username
+	}
+	if username == "" {
+		return &GameError{"username is required"}
+	}
+
+	player := game.Player{ID: c.PlayerID, Username: username}
+	g, err := c.Hub.JoinGame(gameID, player)
+	if err != nil {
+		return err
 	}
+	c.Username = username
+	c.Hub.Mutex.Lock()
+	seat := seatOf(g, player.ID)
+	token := c.Hub.tokens[seatKey(gameID, player.ID)]
+	c.Hub.attachSeat(c, gameID)
+	c.Hub.Mutex.Unlock()
+
+	content, _ := json.Marshal(JoinedMessage{GameID: gameID, PlayerID: player.ID, Seat: seat, SessionToken: token})
+	return c.Hub.Watch(c, gameID, Message{Type: "game_joined", Content: content})
+}
+
+// sendError reports a failed request back to the client
+func (c *Client) sendError(err error) {
+	content, _ := json.Marshal(map[string]string{"message": err.Error()})
+	c.Send <- c.Hub.formatMessage(Message{Type: "error", Content: content})
 }
 
+// ErrGameNotFound is returned for games the hub doesn't know, or no longer
+// keeps
+var ErrGameNotFound = &GameError{"game not found"}
+
+// Errors from joining a game that can't take another player
+var (
+	ErrGameFull    = &GameError{"game is full"}
+	ErrGameStarted = &GameError{"game already started"}
+)
+
 // Simple error type for hub
 type GameError struct {
 	Message string
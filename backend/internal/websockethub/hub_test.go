@@ -0,0 +1,313 @@
+package websockethub
+
+import (
+	"connect-four/internal/bot"
+	"connect-four/internal/game"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// fakeClient registers a client with no connection behind it, in gameID's
+// room if gameID isn't empty. Tests read what the hub sends it from Send.
+func fakeClient(h *Hub, playerID, gameID string) *Client {
+	c := &Client{Hub: h, Send: make(chan []byte, 64), PlayerID: playerID, Username: playerID, GameID: gameID}
+	h.Register <- c
+	return c
+}
+
+// receive returns the next message sent to c
+func receive(t *testing.T, c *Client) Message {
+	t.Helper()
+	select {
+	case data, ok := <-c.Send:
+		if !ok {
+			t.Fatalf("%s was disconnected", c.PlayerID)
+		}
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("%s: %v", c.PlayerID, err)
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatalf("nothing sent to %s", c.PlayerID)
+	}
+	return Message{}
+}
+
+// receiveGame returns the game in the next message sent to c, which must be
+// of type msgType
+func receiveGame(t *testing.T, c *Client, msgType string) *game.Game {
+	t.Helper()
+	msg := receive(t, c)
+	if msg.Type != msgType {
+		t.Fatalf("%s got %s %s, want %s", c.PlayerID, msg.Type, msg.Content, msgType)
+	}
+	var g game.Game
+	if err := json.Unmarshal(msg.Content, &g); err != nil {
+		t.Fatalf("%s: %v", c.PlayerID, err)
+	}
+	return &g
+}
+
+// expectNothing checks nothing is waiting to be sent to c
+func expectNothing(t *testing.T, c *Client) {
+	t.Helper()
+	select {
+	case data := <-c.Send:
+		t.Errorf("%s got %s", c.PlayerID, data)
+	default:
+	}
+}
+
+// startHumanGame creates a game between two players and starts it
+func startHumanGame(t *testing.T, h *Hub, first, second string) *game.Game {
+	t.Helper()
+	g := h.CreateGame(game.Player{ID: first, Username: first}, game.Settings{}, game.StandardSize)
+	if _, err := h.JoinGame(g.ID, game.Player{ID: second, Username: second}); err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+// toMove returns the ID of the player whose turn it is in gameID
+func toMove(h *Hub, gameID string) string {
+	h.Mutex.RLock()
+	defer h.Mutex.RUnlock()
+	return h.Games[gameID].GetCurrentPlayer().ID
+}
+
+func TestRoomsKeepGamesApart(t *testing.T) {
+	h := newTestHub(t)
+	h.MatchTimeout = time.Hour
+	a := startHumanGame(t, h, "a1", "a2")
+	b := startHumanGame(t, h, "b1", "b2")
+
+	inA := []*Client{fakeClient(h, "a1", a.ID), fakeClient(h, "a2", a.ID), fakeClient(h, "spectator", a.ID)}
+	inB := fakeClient(h, "b1", b.ID)
+	lobby := fakeClient(h, "lobby", "")
+
+	if _, err := h.Play(a.ID, toMove(h, a.ID), game.Drop(3)); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range inA {
+		if g := receiveGame(t, c, "game_update"); g.ID != a.ID || len(g.Moves) != 1 {
+			t.Errorf("%s got game %s after %d moves, want %s after 1", c.PlayerID, g.ID, len(g.Moves), a.ID)
+		}
+	}
+
+	// Room messages go out in order, so had a's update gone to b's room it
+	// would come before b's own
+	if _, err := h.Play(b.ID, toMove(h, b.ID), game.Drop(0)); err != nil {
+		t.Fatal(err)
+	}
+	if g := receiveGame(t, inB, "game_update"); g.ID != b.ID {
+		t.Errorf("b1 got an update for game %s", g.ID)
+	}
+	for _, c := range append(inA, lobby) {
+		expectNothing(t, c)
+	}
+
+	// Watching b takes the lobby client into b's room and out of no other
+	if err := h.Watch(lobby, b.ID); err != nil {
+		t.Fatal(err)
+	}
+	if g := receiveGame(t, lobby, "game_update"); g.ID != b.ID || len(g.Moves) != 1 {
+		t.Errorf("watching b sent game %s after %d moves", g.ID, len(g.Moves))
+	}
+	if _, err := h.Play(a.ID, toMove(h, a.ID), game.Drop(3)); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range inA {
+		receiveGame(t, c, "game_update")
+	}
+	if _, err := h.Play(b.ID, toMove(h, b.ID), game.Drop(0)); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*Client{inB, lobby} {
+		if g := receiveGame(t, c, "game_update"); g.ID != b.ID || len(g.Moves) != 2 {
+			t.Errorf("%s got game %s after %d moves, want %s after 2", c.PlayerID, g.ID, len(g.Moves), b.ID)
+		}
+	}
+}
+
+// send hands c's hub a message as if it came over c's connection
+func send(c *Client, msgType string, content interface{}) {
+	data, _ := json.Marshal(content)
+	msg, _ := json.Marshal(Message{Type: msgType, Content: data})
+	c.handleMessage(msg)
+}
+
+func TestJoinGame(t *testing.T) {
+	h := newTestHub(t)
+	h.MatchTimeout = time.Hour
+	waiting := h.CreateGame(game.Player{ID: "host", Username: "host"}, game.Settings{}, game.StandardSize)
+	full := startHumanGame(t, h, "p1", "p2")
+
+	// A game that ended before anyone took its second seat
+	started := game.NewGame("started", game.Player{ID: "left", Username: "left"})
+	started.Status = "finished"
+	h.Mutex.Lock()
+	h.Games[started.ID] = started
+	h.Mutex.Unlock()
+
+	for _, test := range []struct {
+		gameID string
+		err    error
+	}{
+		{"missing", ErrGameNotFound},
+		{full.ID, ErrGameFull},
+		{started.ID, ErrGameStarted},
+	} {
+		c := fakeClient(h, "guest", "")
+		send(c, "join_game", GameMessage{GameID: test.gameID})
+		msg := receive(t, c)
+		var content map[string]string
+		json.Unmarshal(msg.Content, &content)
+		if msg.Type != "error" || content["message"] != test.err.Error() {
+			t.Errorf("joining %s: got %s %s, want error %q", test.gameID, msg.Type, msg.Content, test.err)
+		}
+	}
+
+	c := fakeClient(h, "guest", "")
+	send(c, "join_game", GameMessage{GameID: waiting.ID})
+	msg := receive(t, c)
+	var joined JoinedMessage
+	json.Unmarshal(msg.Content, &joined)
+	if msg.Type != "game_joined" || joined.GameID != waiting.ID || joined.Seat != 1 || joined.SessionToken == "" {
+		t.Fatalf("got %s %s, want to be seated second", msg.Type, msg.Content)
+	}
+	if g := receiveGame(t, c, "game_update"); g.Status != "playing" || g.Players[1].ID != "guest" {
+		t.Errorf("joined game is %s with %+v in the second seat", g.Status, g.Players[1])
+	}
+}
+
+// disconnect does what ReadPump does when c's connection closes
+func disconnect(c *Client) {
+	c.Hub.CancelMatch(c)
+	c.Hub.leaveSeat(c)
+	c.Hub.Unregister <- c
+}
+
+// presence returns the presence message in the next message sent to c, which
+// must be of type msgType
+func presence(t *testing.T, c *Client, msgType string) PresenceMessage {
+	t.Helper()
+	msg := receive(t, c)
+	if msg.Type != msgType {
+		t.Fatalf("%s got %s %s, want %s", c.PlayerID, msg.Type, msg.Content, msgType)
+	}
+	var p PresenceMessage
+	json.Unmarshal(msg.Content, &p)
+	return p
+}
+
+// seatedClients connects both players of g and seats them
+func seatedClients(h *Hub, g *game.Game) [2]*Client {
+	var clients [2]*Client
+	for seat, p := range g.Players {
+		clients[seat] = fakeClient(h, p.ID, g.ID)
+		h.AttachSeat(clients[seat], g.ID)
+	}
+	return clients
+}
+
+func TestReconnectWithinGracePeriod(t *testing.T) {
+	h := newTestHub(t)
+	h.MatchTimeout = time.Hour
+	h.GracePeriod = 200 * time.Millisecond
+	g := startHumanGame(t, h, "p1", "p2")
+	clients := seatedClients(h, g)
+
+	disconnect(clients[0])
+	if p := presence(t, clients[1], "player_disconnected"); p.PlayerID != "p1" || p.Seat != 0 || p.GraceMs != 200 {
+		t.Errorf("disconnect announced as %+v", p)
+	}
+
+	token := h.SessionToken(g.ID, "p1")
+	gameID, player, err := h.Session(token)
+	if err != nil || gameID != g.ID || player.ID != "p1" {
+		t.Fatalf("session %q is for %s in %s: %v", token, player.ID, gameID, err)
+	}
+	back := fakeClient(h, player.ID, gameID)
+	h.AttachSeat(back, gameID)
+	if err := h.Watch(back, gameID); err != nil {
+		t.Fatal(err)
+	}
+	if p := presence(t, clients[1], "player_reconnected"); p.PlayerID != "p1" || p.Seat != 0 {
+		t.Errorf("return announced as %+v", p)
+	}
+	presence(t, back, "player_reconnected")
+	if snapshot := receiveGame(t, back, "game_update"); snapshot.ID != g.ID || snapshot.Status != "playing" {
+		t.Errorf("snapshot of game %s, %s", snapshot.ID, snapshot.Status)
+	}
+
+	// The seat is still p1's once the grace period would have run out
+	time.Sleep(2 * h.GracePeriod)
+	expectNothing(t, clients[1])
+	if toMove(h, g.ID) == "p2" {
+		if _, err := h.Play(g.ID, "p2", game.Drop(3)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := h.Play(g.ID, "p1", game.Drop(3)); err != nil {
+		t.Errorf("p1 can't move after coming back: %v", err)
+	}
+}
+
+func TestForfeitAfterGracePeriod(t *testing.T) {
+	h := newTestHub(t)
+	h.MatchTimeout = time.Hour
+	h.GracePeriod = 50 * time.Millisecond
+	g := startHumanGame(t, h, "p1", "p2")
+	clients := seatedClients(h, g)
+
+	disconnect(clients[1])
+	presence(t, clients[0], "player_disconnected")
+	if p := presence(t, clients[0], "player_forfeited"); p.PlayerID != "p2" || p.Seat != 1 {
+		t.Errorf("forfeit announced as %+v", p)
+	}
+	final := receiveGame(t, clients[0], "game_update")
+	if final.Status != "finished" || final.Winner != 0 || final.Result != game.ResultForfeit {
+		t.Errorf("game %s with winner %d and result %q, want p1 to win by forfeit", final.Status, final.Winner, final.Result)
+	}
+	if _, err := h.Play(g.ID, toMove(h, g.ID), game.Drop(0)); err == nil {
+		t.Error("played on after the forfeit")
+	}
+}
+
+func TestHintDoesNotBlockMessages(t *testing.T) {
+	h := newTestHub(t)
+	h.MatchTimeout = time.Hour
+	h.HintDifficulty = bot.Easy
+	g := startHumanGame(t, h, "p1", "p2")
+	c := fakeClient(h, "p1", g.ID)
+
+	// The hint can't be worked out while the hub is locked, but the request
+	// is handled all the same
+	h.Mutex.Lock()
+	handled := make(chan struct{})
+	go func() {
+		send(c, "get_hint", GameMessage{GameID: g.ID})
+		close(handled)
+	}()
+	select {
+	case <-handled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("get_hint waited for the search")
+	}
+	h.Mutex.Unlock()
+
+	msg := receive(t, c)
+	var hint HintMessage
+	json.Unmarshal(msg.Content, &hint)
+	if msg.Type != "hint" || hint.GameID != g.ID || hint.Analysis == nil {
+		t.Errorf("got %s %s, want a hint", msg.Type, msg.Content)
+	}
+
+	send(c, "get_hint", GameMessage{GameID: "missing"})
+	if msg := receive(t, c); msg.Type != "error" {
+		t.Errorf("hint for a missing game got %s %s", msg.Type, msg.Content)
+	}
+	c.hints.Wait()
+}
@@ -0,0 +1,465 @@
+package websockethub
+
+import (
+	"connect-four/internal/bot"
+	"connect-four/internal/game"
+	"connect-four/internal/rating"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The matchmaking queue pairs players who want the same kind of game: the
+// same variant, board, mode and time control. Players ask for a match over
+// websocket with find_match and are paired first come, first served with
+// someone close to their rating: within RatingWindow at first, widening by
+// WindowGrowth every second either of them has waited. Games created over
+// HTTP wait in the queue too, so a player looking for a match can take their
+// free seat. Whoever is still unmatched after MatchTimeout plays a bot of
+// about their rating instead.
+
+// MatchRequest is what a player asks the queue for with find_match. Empty
+// fields take the same defaults as a game created over HTTP.
+type MatchRequest struct {
+	Username      string `json:"username"`
+	BotDifficulty string `json:"botDifficulty"` // the bot played if nobody is found; one near the player's rating if empty
+	BotEngine     string `json:"botEngine"`
+	Mode          string `json:"mode"`
+	Variant       string `json:"variant"`
+	TimeControl   string `json:"timeControl"`
+	Rows          int    `json:"rows"`
+	Columns       int    `json:"columns"`
+	Connect       int    `json:"connect"`
+}
+
+// QueuedMessage confirms a find_match request
+type QueuedMessage struct {
+	Settings  game.Settings `json:"settings"`
+	Size      game.Size     `json:"size"`
+	Rating    int           `json:"rating"`    // the player's, which opponents are picked by
+	TimeoutMs int64         `json:"timeoutMs"` // until a bot is played instead
+}
+
+// queueEntry is a player waiting for an opponent: either a client looking for
+// a match, or the creator of a waiting game.
+type queueEntry struct {
+	key      string // kind of game wanted; "" if only joining by ID will do
+	player   game.Player
+	settings game.Settings
+	size     game.Size
+	rating   int
+	since    time.Time
+	client   *Client    // the client looking for a match, nil for a game
+	game     *game.Game // the waiting game, nil for a client
+	timer    *time.Timer
+}
+
+// Errors from the matchmaking queue
+var (
+	ErrAlreadyQueued = &GameError{"already looking for a match"}
+	ErrNotQueued     = &GameError{"not looking for a match"}
+)
+
+// FindMatch puts client in the queue for the kind of game req asks for. If
+// someone is already waiting for one, the game starts straight away;
+// otherwise the client is told it is queued. Either way the client hears
+// match_found and moves to the game's room once it has an opponent.
+func (h *Hub) FindMatch(client *Client, req MatchRequest) error {
+	settings, size, err := h.parseMatchRequest(req)
+	if err != nil {
+		return err
+	}
+	username := req.Username
+	if username == "" {
+		username = client.Username
+	}
+	if username == "" {
+		return &GameError{"username is required"}
+	}
+	playerRating := h.ratingOf(username)
+
+	h.Mutex.Lock()
+	if _, queued := h.queued[client]; queued {
+		h.Mutex.Unlock()
+		return ErrAlreadyQueued
+	}
+	entry := &queueEntry{
+		key:      matchKey(settings, size),
+		player:   game.Player{ID: client.PlayerID, Username: username},
+		settings: settings,
+		size:     size,
+		rating:   playerRating,
+		since:    time.Now(),
+		client:   client,
+	}
+	if opponent := h.opponentFor(entry); opponent != nil {
+		h.dequeue(opponent)
+		g := h.match(opponent, entry)
+		h.Mutex.Unlock()
+		h.announceMatch(g, opponent, entry)
+		return nil
+	}
+	h.enqueue(entry)
+	h.Mutex.Unlock()
+
+	client.Username = username
+	content, _ := json.Marshal(QueuedMessage{Settings: settings, Size: size, Rating: playerRating, TimeoutMs: h.MatchTimeout.Milliseconds()})
+	client.Send <- h.formatMessage(Message{Type: "match_queued", Content: content})
+	return nil
+}
+
+// CancelMatch takes client out of the queue. It fails with ErrNotQueued if
+// the client wasn't waiting, for instance because a match was just found.
+func (h *Hub) CancelMatch(client *Client) error {
+	h.Mutex.Lock()
+	defer h.Mutex.Unlock()
+
+	entry, queued := h.queued[client]
+	if !queued {
+		return ErrNotQueued
+	}
+	h.dequeue(entry)
+	log.Printf("Player %s left the matchmaking queue", client.PlayerID)
+	return nil
+}
+
+// queueGame puts a game waiting for its second player in the queue, so a
+// player looking for the same kind of game can join it. Games starting from
+// a set position only take players who know their ID. creatorRating is the
+// first player's rating. Callers hold the lock.
+func (h *Hub) queueGame(g *game.Game, private bool, creatorRating int) {
+	entry := &queueEntry{
+		player:   g.Players[0],
+		settings: g.Settings,
+		size:     g.Size,
+		rating:   creatorRating,
+		since:    time.Now(),
+		game:     g,
+	}
+	if !private {
+		entry.key = matchKey(g.Settings, g.Size)
+		if opponent := h.opponentFor(entry); opponent != nil {
+			h.dequeue(opponent)
+			h.match(opponent, entry)
+			go h.announceMatch(g, opponent)
+			return
+		}
+	}
+	h.enqueue(entry)
+}
+
+// unqueueGame takes a game out of the queue, once it was joined by ID or is
+// being removed. Callers hold the lock.
+func (h *Hub) unqueueGame(gameID string) {
+	if entry, ok := h.hosts[gameID]; ok {
+		h.dequeue(entry)
+	}
+}
+
+// opponentFor finds who entry should play: the longest waiting entry for the
+// same kind of game that it can be paired with. Callers hold the lock.
+func (h *Hub) opponentFor(entry *queueEntry) *queueEntry {
+	if entry.key == "" {
+		return nil
+	}
+	now := time.Now()
+	for _, waiting := range h.queues[entry.key] {
+		if h.canPair(waiting, entry, now) {
+			return waiting
+		}
+	}
+	return nil
+}
+
+// canPair reports whether two entries for the same kind of game may play
+// each other: their ratings must be within the wider of their windows. Two
+// waiting games can't be merged, so a game only pairs with a client.
+func (h *Hub) canPair(a, b *queueEntry, now time.Time) bool {
+	if a.game != nil && b.game != nil {
+		return false
+	}
+	if a.player.ID == b.player.ID {
+		return false
+	}
+	window := h.ratingWindow(now.Sub(a.since))
+	if w := h.ratingWindow(now.Sub(b.since)); w > window {
+		window = w
+	}
+	gap := a.rating - b.rating
+	return gap <= window && -gap <= window
+}
+
+// ratingWindow is how far from their rating a player who has waited for so
+// long accepts an opponent
+func (h *Hub) ratingWindow(waited time.Duration) int {
+	return h.RatingWindow + int(float64(h.WindowGrowth)*waited.Seconds())
+}
+
+// matchSweepInterval is how often waiting players are checked again as their
+// windows widen
+const matchSweepInterval = 250 * time.Millisecond
+
+// matchmakingRoutine pairs players who were left waiting once their rating
+// windows take each other in.
+func (h *Hub) matchmakingRoutine() {
+	ticker := time.NewTicker(matchSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		h.sweepQueues()
+	}
+}
+
+// sweepQueues pairs every two waiting entries that can now play each other,
+// longest waiting first.
+func (h *Hub) sweepQueues() {
+	type pairing struct {
+		game    *game.Game
+		entries [2]*queueEntry
+	}
+	var pairings []pairing
+
+	h.Mutex.Lock()
+	now := time.Now()
+	for key := range h.queues {
+		for paired := true; paired; {
+			paired = false
+			waiting := h.queues[key]
+		search:
+			for i, a := range waiting {
+				for _, b := range waiting[i+1:] {
+					if h.canPair(a, b, now) {
+						h.dequeue(a)
+						h.dequeue(b)
+						pairings = append(pairings, pairing{h.match(a, b), [2]*queueEntry{a, b}})
+						paired = true
+						break search
+					}
+				}
+			}
+		}
+	}
+	h.Mutex.Unlock()
+
+	for _, p := range pairings {
+		h.announceMatch(p.game, p.entries[0], p.entries[1])
+	}
+}
+
+// enqueue adds entry to the back of its queue and starts its timeout.
+// Callers hold the lock.
+func (h *Hub) enqueue(entry *queueEntry) {
+	if entry.key != "" {
+		h.queues[entry.key] = append(h.queues[entry.key], entry)
+	}
+	if entry.client != nil {
+		h.queued[entry.client] = entry
+	} else {
+		h.hosts[entry.game.ID] = entry
+	}
+	entry.timer = time.AfterFunc(h.MatchTimeout, func() { h.expireQueueEntry(entry) })
+	log.Printf("Player %s queued for a match (%s)", entry.player.ID, entry.key)
+}
+
+// dequeue takes entry out of the queue and stops its timeout. Callers hold
+// the lock.
+func (h *Hub) dequeue(entry *queueEntry) {
+	if entry.timer != nil {
+		entry.timer.Stop()
+	}
+	waiting := h.queues[entry.key]
+	for i, e := range waiting {
+		if e == entry {
+			waiting = append(waiting[:i:i], waiting[i+1:]...)
+			break
+		}
+	}
+	if len(waiting) == 0 {
+		delete(h.queues, entry.key)
+	} else {
+		h.queues[entry.key] = waiting
+	}
+	if entry.client != nil {
+		delete(h.queued, entry.client)
+	} else {
+		delete(h.hosts, entry.game.ID)
+	}
+}
+
+// isQueued reports whether entry is still waiting. Callers hold the lock.
+func (h *Hub) isQueued(entry *queueEntry) bool {
+	if entry.client != nil {
+		return h.queued[entry.client] == entry
+	}
+	return h.hosts[entry.game.ID] == entry
+}
+
+// match starts a game between two entries taken out of the queue, first the
+// one that waited longer. A waiting game of either becomes theirs; otherwise
+// a new one is created. Callers hold the lock.
+func (h *Hub) match(first, second *queueEntry) *game.Game {
+	host, guest := first, second
+	if second.game != nil {
+		host, guest = second, first
+	}
+	g := host.game
+	if g == nil {
+		g = game.NewGameWithSettings(generateGameID(), host.player, host.settings, host.size)
+		h.Games[g.ID] = g
+	}
+	g.AddPlayer(guest.player)
+	h.issueSessions(g)
+	log.Printf("Matched %s with %s in game %s", first.player.ID, second.player.ID, g.ID)
+
+	h.broadcastGameUpdate(g)
+	return g
+}
+
+// expireQueueEntry seats a bot against entry if it is still waiting
+func (h *Hub) expireQueueEntry(entry *queueEntry) {
+	h.Mutex.Lock()
+	if h.ctx.Err() != nil || !h.isQueued(entry) {
+		h.Mutex.Unlock()
+		return
+	}
+	h.dequeue(entry)
+
+	g := entry.game
+	if g == nil {
+		g = game.NewGameWithSettings(generateGameID(), entry.player, entry.settings, entry.size)
+		h.Games[g.ID] = g
+	}
+	difficulty := bot.ForRating(entry.rating)
+	if g.Settings.BotDifficulty != "" {
+		d, err := bot.ParseDifficulty(g.Settings.BotDifficulty)
+		if err != nil {
+			log.Printf("Invalid bot difficulty %q for game %s, using one near the player's rating", g.Settings.BotDifficulty, g.ID)
+		} else {
+			difficulty = d
+		}
+	}
+
+	log.Printf("No match for %s (rated %d), adding %s bot to game %s...", entry.player.ID, entry.rating, difficulty, g.ID)
+	g.AddBot(string(difficulty), "")
+	h.issueSessions(g)
+	h.broadcastGameUpdate(g)
+
+	// If bot goes first, trigger bot move immediately
+	botFirst := g.Status == "playing" && g.GetCurrentPlayer().IsBot
+	h.Mutex.Unlock()
+
+	h.announceMatch(g, entry)
+	if botFirst {
+		go h.makeBotMove(g.ID)
+	}
+}
+
+// announceMatch tells the clients of entries that they have a game and moves
+// them to its room. Entries for waiting games already have theirs.
+func (h *Hub) announceMatch(g *game.Game, entries ...*queueEntry) {
+	for _, entry := range entries {
+		if entry.client == nil {
+			continue
+		}
+		h.Mutex.Lock()
+		seat := seatOf(g, entry.player.ID)
+		token := h.tokens[seatKey(g.ID, entry.player.ID)]
+		h.attachSeat(entry.client, g.ID)
+		h.Mutex.Unlock()
+
+		// Sent by the Run goroutine, in case the client has just gone
+		content, _ := json.Marshal(JoinedMessage{GameID: g.ID, PlayerID: entry.player.ID, Seat: seat, SessionToken: token})
+		found := Message{Type: "match_found", Content: content}
+		if err := h.Watch(entry.client, g.ID, found); err != nil {
+			log.Printf("Watch error for %s: %v", entry.player.ID, err)
+		}
+	}
+}
+
+// parseMatchRequest validates req the way game creation does
+func (h *Hub) parseMatchRequest(req MatchRequest) (game.Settings, game.Size, error) {
+	var difficulty bot.Difficulty
+	if req.BotDifficulty != "" {
+		d, err := bot.ParseDifficulty(req.BotDifficulty)
+		if err != nil {
+			return game.Settings{}, game.Size{}, err
+		}
+		difficulty = d
+	}
+	engine, err := h.Engines.Parse(req.BotEngine)
+	if err != nil {
+		return game.Settings{}, game.Size{}, err
+	}
+	mode, err := game.ParseMode(req.Mode)
+	if err != nil {
+		return game.Settings{}, game.Size{}, err
+	}
+	variant, err := game.ParseVariant(req.Variant)
+	if err != nil {
+		return game.Settings{}, game.Size{}, err
+	}
+	size, err := game.ParseVariantSize(variant, req.Rows, req.Columns, req.Connect)
+	if err != nil {
+		return game.Settings{}, game.Size{}, err
+	}
+	if err := checkTimeControl(req.TimeControl); err != nil {
+		return game.Settings{}, game.Size{}, err
+	}
+	return game.Settings{
+		BotDifficulty: string(difficulty),
+		BotEngine:     engine,
+		Mode:          mode,
+		Variant:       variant,
+		TimeControl:   req.TimeControl,
+	}, size, nil
+}
+
+// ratingOf returns a player's rating, or the default one when ratings aren't
+// kept
+func (h *Hub) ratingOf(username string) int {
+	if h.Ratings == nil {
+		return rating.Default
+	}
+	return h.Ratings.Get(username)
+}
+
+// checkTimeControl accepts an empty time control or one written as minutes
+// per player and seconds added per move, e.g. "5+3".
+func checkTimeControl(tc string) error {
+	if tc == "" {
+		return nil
+	}
+	minutes, increment, ok := strings.Cut(tc, "+")
+	if !ok {
+		return &GameError{"time control must look like 5+3"}
+	}
+	if m, err := strconv.Atoi(minutes); err != nil || m < 1 {
+		return &GameError{"time control must look like 5+3"}
+	}
+	if s, err := strconv.Atoi(increment); err != nil || s < 0 {
+		return &GameError{"time control must look like 5+3"}
+	}
+	return nil
+}
+
+// matchKey names the kind of game settings and size describe. Only players
+// wanting the same kind are paired.
+func matchKey(settings game.Settings, size game.Size) string {
+	variant := settings.Variant
+	if variant == "" {
+		variant = game.VariantStandard
+	}
+	mode := settings.Mode
+	if mode == "" {
+		mode = game.ModeCasual
+	}
+	return fmt.Sprintf("%s %dx%d/%d %s %s", variant, size.Columns, size.Rows, size.Connect, mode, settings.TimeControl)
+}
@@ -0,0 +1,243 @@
+package websockethub
+
+import (
+	"connect-four/internal/bot"
+	"connect-four/internal/game"
+	"connect-four/internal/rating"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The simulation is kept small by default; larger runs can be asked for, e.g.
+//
+//	go test ./internal/websockethub -run Simulation -sim.players 400 -sim.rate 4 -sim.spread 400
+var (
+	simPlayers = flag.Int("sim.players", 60, "number of synthetic players")
+	simRate    = flag.Float64("sim.rate", 4, "players arriving per second")
+	simSpread  = flag.Int("sim.spread", 250, "standard deviation of ratings")
+	simWindow  = flag.Int("sim.window", 100, "rating window when a player starts waiting")
+	simGrowth  = flag.Int("sim.growth", 50, "rating window growth per second waited")
+	simTimeout = flag.Duration("sim.timeout", 10*time.Second, "wait before a bot is played")
+	simSpeedup = flag.Float64("sim.speedup", 10, "how much faster than real time to run")
+	simSeed    = flag.Int64("sim.seed", 1, "random seed")
+)
+
+// simResult is what one synthetic player saw
+type simResult struct {
+	GameID   string
+	Rating   int
+	Wait     time.Duration // in simulated time
+	Opponent int           // the opponent's rating, or the bot's
+	Bot      string        // the bot's difficulty, if one was played
+}
+
+// TestMatchmakingSimulation runs the queue against synthetic players with
+// normally distributed ratings, arriving at random and looking for a rated
+// game, and checks that nobody waits too long or is paired outside their
+// rating window. The queue runs faster than real time by -sim.speedup; waits
+// are reported in simulated time.
+func TestMatchmakingSimulation(t *testing.T) {
+	if !testing.Verbose() {
+		log.SetOutput(io.Discard)
+		defer log.SetOutput(os.Stderr)
+	}
+	rng := rand.New(rand.NewSource(*simSeed))
+	speedup := *simSpeedup
+
+	ratings := rating.NewMemoryStore()
+	h := newTestHub(t)
+	h.Ratings = rating.New(ratings)
+	h.RatingWindow = *simWindow
+	h.WindowGrowth = int(float64(*simGrowth) * speedup)
+	h.MatchTimeout = time.Duration(float64(*simTimeout) / speedup)
+	h.BotThinkTime = time.Millisecond
+
+	results := make([]simResult, *simPlayers)
+	var wg sync.WaitGroup
+	for i := range results {
+		r := rating.Default + int(rng.NormFloat64()*float64(*simSpread))
+		name := "player" + strconv.Itoa(i)
+		ratings.SaveRating(name, r)
+		results[i].Rating = r
+
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			results[i] = simulatePlayer(t, h, name, results[i].Rating, ratings, speedup)
+		}(i, name)
+
+		arrival := time.Duration(rng.ExpFloat64() / *simRate * float64(time.Second))
+		time.Sleep(time.Duration(float64(arrival) / speedup))
+	}
+	wg.Wait()
+
+	checkSimulation(t, results, *simWindow, *simGrowth, *simTimeout, speedup)
+}
+
+// A player nobody else is looking for plays the bot nearest their rating
+func TestMatchmakingBotFallback(t *testing.T) {
+	ratings := rating.NewMemoryStore()
+	ratings.SaveRating("loner", 1650)
+	h := newTestHub(t)
+	h.Ratings = rating.New(ratings)
+	h.MatchTimeout = 100 * time.Millisecond
+
+	res := simulatePlayer(t, h, "loner", 1650, ratings, 1)
+	if want := bot.ForRating(1650); res.Bot != string(want) {
+		t.Errorf("played a %q bot, want %s", res.Bot, want)
+	}
+	if res.Wait < h.MatchTimeout {
+		t.Errorf("got a bot after %s, before the %s timeout", res.Wait, h.MatchTimeout)
+	}
+}
+
+// simulatePlayer queues one player and waits for their game to start
+func simulatePlayer(t *testing.T, h *Hub, name string, playerRating int, ratings rating.Store, speedup float64) simResult {
+	client := &Client{Hub: h, Send: make(chan []byte, 64), PlayerID: name, Username: name}
+	h.Register <- client
+
+	res := simResult{Rating: playerRating}
+	start := time.Now()
+	if err := h.FindMatch(client, MatchRequest{Mode: game.ModeRated}); err != nil {
+		t.Errorf("Error queueing %s: %v", name, err)
+		return res
+	}
+
+	found := false
+	for data := range client.Send {
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+		switch msg.Type {
+		case "match_found":
+			res.Wait = time.Duration(float64(time.Since(start)) * speedup)
+			var joined JoinedMessage
+			json.Unmarshal(msg.Content, &joined)
+			res.GameID = joined.GameID
+			found = true
+		case "game_update":
+			if !found {
+				continue
+			}
+			var g game.Game
+			json.Unmarshal(msg.Content, &g)
+			for _, p := range g.Players {
+				switch {
+				case p.IsBot:
+					res.Bot = p.BotLevel
+					res.Opponent = bot.Difficulty(p.BotLevel).Level().Rating
+				case p.Username != name:
+					res.Opponent, _ = ratings.GetRating(p.Username)
+				}
+			}
+			h.Unregister <- client
+			return res
+		}
+	}
+	return res
+}
+
+// checkSimulation logs wait times and rating gaps and checks them against
+// the queue's rules.
+func checkSimulation(t *testing.T, results []simResult, window, growth int, timeout time.Duration, speedup float64) {
+	// The queue is only swept every matchSweepInterval
+	slack := time.Duration(float64(matchSweepInterval+50*time.Millisecond) * speedup)
+
+	var humanWaits, botWaits []time.Duration
+	var humanGaps, botGaps []int
+	for _, r := range results {
+		gap := abs(r.Rating - r.Opponent)
+		if r.Bot != "" {
+			botWaits = append(botWaits, r.Wait)
+			botGaps = append(botGaps, gap)
+			if r.Wait < timeout {
+				t.Errorf("player rated %d got a bot after %s", r.Rating, r.Wait.Round(time.Millisecond))
+			}
+			if want := bot.ForRating(r.Rating); r.Bot != string(want) {
+				t.Errorf("player rated %d got a %s bot, want %s", r.Rating, r.Bot, want)
+			}
+			continue
+		}
+		humanWaits = append(humanWaits, r.Wait)
+		humanGaps = append(humanGaps, gap)
+		if r.Wait > timeout+slack {
+			t.Errorf("player rated %d waited %s for an opponent", r.Rating, r.Wait.Round(time.Millisecond))
+		}
+	}
+
+	// Both players of a game were paired at once, by the window of the one
+	// who waited longer
+	longest := make(map[string]time.Duration)
+	for _, r := range results {
+		if r.Bot == "" && r.Wait > longest[r.GameID] {
+			longest[r.GameID] = r.Wait
+		}
+	}
+	for _, r := range results {
+		if r.Bot != "" {
+			continue
+		}
+		allowed := window + int(float64(growth)*(longest[r.GameID]+slack).Seconds())
+		if gap := abs(r.Rating - r.Opponent); gap > allowed {
+			t.Errorf("player rated %d met %d after %s, window %d", r.Rating, r.Opponent, r.Wait.Round(time.Millisecond), allowed)
+		}
+	}
+
+	t.Logf("%d players: %d matched with a human, %d with a bot", len(results), len(humanWaits), len(botWaits))
+	t.Logf("%-12s %10s %10s %10s %8s %8s %8s", "", "wait p50", "wait p90", "wait max", "gap p50", "gap p90", "gap max")
+	logSimulationRow(t, "human", humanWaits, humanGaps)
+	logSimulationRow(t, "bot", botWaits, botGaps)
+	t.Logf("random pairing would average a gap of %d", randomGap(results))
+}
+
+func logSimulationRow(t *testing.T, label string, waits []time.Duration, gaps []int) {
+	if len(waits) == 0 {
+		t.Logf("%-12s %10s", label, "-")
+		return
+	}
+	sort.Slice(waits, func(i, j int) bool { return waits[i] < waits[j] })
+	sort.Ints(gaps)
+	t.Logf("%-12s %10s %10s %10s %8d %8d %8d", label,
+		percentile(waits, 0.5).Round(100*time.Millisecond),
+		percentile(waits, 0.9).Round(100*time.Millisecond),
+		waits[len(waits)-1].Round(100*time.Millisecond),
+		gaps[len(gaps)/2], gaps[len(gaps)*9/10], gaps[len(gaps)-1])
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	return sorted[int(math.Min(float64(len(sorted)-1), p*float64(len(sorted))))]
+}
+
+// randomGap is the average rating gap between two players picked at random,
+// what pairing by arrival alone would give
+func randomGap(results []simResult) int {
+	total, n := 0, 0
+	for i := range results {
+		for j := i + 1; j < len(results); j++ {
+			total += abs(results[i].Rating - results[j].Rating)
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return total / n
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,116 @@
+package websockethub
+
+import (
+	"encoding/json"
+	"log"
+)
+
+// Every game has a room: the clients watching it, whether they play in it or
+// spectate. A client is in the room of its GameID, set from the gameId it
+// connected with and changed by Watch. Messages about a game go to its room
+// only, so a move costs a fan-out to that game's clients rather than to
+// everyone connected.
+
+// RoomMessage is a Message for the clients in one game's room
+type RoomMessage struct {
+	GameID  string
+	Message Message
+}
+
+// roomChange moves a client into another game's room, then sends it
+// messages, as long as it is still connected
+type roomChange struct {
+	client   *Client
+	gameID   string
+	messages [][]byte
+}
+
+// enterRoom adds a registered client to the room of its GameID. Only the Run
+// goroutine calls it.
+func (h *Hub) enterRoom(client *Client) {
+	if client.GameID == "" {
+		return
+	}
+	room, ok := h.rooms[client.GameID]
+	if !ok {
+		room = make(map[*Client]bool)
+		h.rooms[client.GameID] = room
+	}
+	room[client] = true
+}
+
+// leaveRoom takes a client out of its room, dropping rooms that empty. Only
+// the Run goroutine calls it.
+func (h *Hub) leaveRoom(client *Client) {
+	room := h.rooms[client.GameID]
+	delete(room, client)
+	if len(room) == 0 {
+		delete(h.rooms, client.GameID)
+	}
+}
+
+// removeClient forgets a client and closes its Send channel. Only the Run
+// goroutine calls it.
+func (h *Hub) removeClient(client *Client) {
+	h.leaveRoom(client)
+	delete(h.Clients, client)
+	close(client.Send)
+}
+
+// sendToRoom delivers a message to every client in a game's room. Clients
+// too slow to keep up are dropped. Only the Run goroutine calls it.
+func (h *Hub) sendToRoom(message RoomMessage) {
+	data := h.formatMessage(message.Message)
+	for client := range h.rooms[message.GameID] {
+		select {
+		case client.Send <- data:
+		default:
+			h.removeClient(client)
+		}
+	}
+}
+
+// changeRoom applies a roomChange. Only the Run goroutine calls it.
+func (h *Hub) changeRoom(change roomChange) {
+	if _, ok := h.Clients[change.client]; !ok {
+		return
+	}
+	h.leaveRoom(change.client)
+	change.client.GameID = change.gameID
+	h.enterRoom(change.client)
+	for _, data := range change.messages {
+		select {
+		case change.client.Send <- data:
+		default:
+			h.removeClient(change.client)
+			return
+		}
+	}
+}
+
+// Watch moves client into gameID's room, leaving the one it was in, and sends
+// it the game's current state, after any messages given.
+func (h *Hub) Watch(client *Client, gameID string, messages ...Message) error {
+	h.Mutex.RLock()
+	g, exists := h.Games[gameID]
+	var gameJSON []byte
+	if exists {
+		gameJSON, _ = json.Marshal(g)
+	}
+	h.Mutex.RUnlock()
+	if !exists {
+		return ErrGameNotFound
+	}
+
+	change := roomChange{client: client, gameID: gameID}
+	for _, msg := range append(messages, Message{Type: "game_update", Content: gameJSON}) {
+		change.messages = append(change.messages, h.formatMessage(msg))
+	}
+	select {
+	case h.roomChanges <- change:
+	case <-h.ctx.Done():
+		return h.ctx.Err()
+	}
+	log.Printf("Client %s now watching game %s", client.PlayerID, gameID)
+	return nil
+}
@@ -0,0 +1,221 @@
+package websockethub
+
+import (
+	"connect-four/internal/game"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// Every human seat gets a session token when it is taken. A client that
+// connects with ?session=<token> plays as that seat's player, so a player who
+// lost their connection can take their seat back. A player none of whose
+// connections are open is absent: the game's room is told, and if they don't
+// come back within GracePeriod they forfeit.
+
+// session is the seat a token stands for
+type session struct {
+	gameID   string
+	playerID string
+}
+
+// absence is a player waiting to come back before they forfeit
+type absence struct {
+	timer *time.Timer
+}
+
+// PresenceMessage tells a game's room that a player left, came back or
+// forfeited
+type PresenceMessage struct {
+	GameID   string `json:"gameId"`
+	PlayerID string `json:"playerId"`
+	Seat     int    `json:"seat"`
+	GraceMs  int64  `json:"graceMs,omitempty"` // until the absent player forfeits
+}
+
+// ErrUnknownSession is returned for tokens the hub didn't issue, or whose
+// game it no longer keeps
+var ErrUnknownSession = &GameError{"unknown session"}
+
+// Session returns the game and player a session token stands for.
+func (h *Hub) Session(token string) (string, game.Player, error) {
+	h.Mutex.RLock()
+	defer h.Mutex.RUnlock()
+
+	s, ok := h.sessions[token]
+	if !ok {
+		return "", game.Player{}, ErrUnknownSession
+	}
+	g, exists := h.Games[s.gameID]
+	if !exists {
+		return "", game.Player{}, ErrUnknownSession
+	}
+	return s.gameID, g.Players[seatOf(g, s.playerID)], nil
+}
+
+// SessionToken returns the token of playerID's seat in a game, or "" if it
+// has none.
+func (h *Hub) SessionToken(gameID, playerID string) string {
+	h.Mutex.RLock()
+	defer h.Mutex.RUnlock()
+	return h.tokens[seatKey(gameID, playerID)]
+}
+
+// issueSessions gives every human seat of g that has no token one. Callers
+// hold the lock.
+func (h *Hub) issueSessions(g *game.Game) {
+	for _, p := range g.Players {
+		if p.ID == "" || p.IsBot {
+			continue
+		}
+		key := seatKey(g.ID, p.ID)
+		if _, ok := h.tokens[key]; ok {
+			continue
+		}
+		token := newSessionToken()
+		h.tokens[key] = token
+		h.sessions[token] = session{gameID: g.ID, playerID: p.ID}
+	}
+}
+
+// dropSessions forgets the tokens and absences of a game being removed.
+// Callers hold the lock.
+func (h *Hub) dropSessions(g *game.Game) {
+	h.clearAbsences(g)
+	for _, p := range g.Players {
+		key := seatKey(g.ID, p.ID)
+		if token, ok := h.tokens[key]; ok {
+			delete(h.sessions, token)
+			delete(h.tokens, key)
+		}
+	}
+}
+
+// AttachSeat counts client as present for its player's seat in gameID, if
+// the player has one there. A player who was absent is back.
+func (h *Hub) AttachSeat(client *Client, gameID string) {
+	h.Mutex.Lock()
+	defer h.Mutex.Unlock()
+	h.attachSeat(client, gameID)
+}
+
+// attachSeat is AttachSeat for callers holding the lock
+func (h *Hub) attachSeat(client *Client, gameID string) {
+	g, exists := h.Games[gameID]
+	if !exists {
+		return
+	}
+	seat := seatOf(g, client.PlayerID)
+	if seat == -1 || g.Players[seat].IsBot || client.seatGame == gameID || client.closed {
+		return
+	}
+	h.detachSeat(client)
+
+	client.seatGame = gameID
+	key := seatKey(gameID, client.PlayerID)
+	h.presence[key]++
+	if a, ok := h.absences[key]; ok {
+		a.timer.Stop()
+		delete(h.absences, key)
+		log.Printf("Player %s is back in game %s", client.PlayerID, gameID)
+		h.broadcastPresence("player_reconnected", PresenceMessage{GameID: gameID, PlayerID: client.PlayerID, Seat: seat})
+	}
+}
+
+// leaveSeat gives up the seat of a client that disconnected, for good: a
+// match announced after this can't seat it again.
+func (h *Hub) leaveSeat(client *Client) {
+	h.Mutex.Lock()
+	defer h.Mutex.Unlock()
+	client.closed = true
+	h.detachSeat(client)
+}
+
+// detachSeat stops counting client as present for its seat. If it was the
+// player's last connection to a game in progress, the player is absent until
+// they come back or GracePeriod runs out. Callers hold the lock.
+func (h *Hub) detachSeat(client *Client) {
+	gameID, playerID := client.seatGame, client.PlayerID
+	if gameID == "" {
+		return
+	}
+	client.seatGame = ""
+	key := seatKey(gameID, playerID)
+	if h.presence[key]--; h.presence[key] > 0 {
+		return
+	}
+	delete(h.presence, key)
+
+	g, exists := h.Games[gameID]
+	if !exists || g.Status != "playing" {
+		return
+	}
+	a := &absence{}
+	a.timer = time.AfterFunc(h.GracePeriod, func() { h.expireAbsence(gameID, playerID, a) })
+	h.absences[key] = a
+
+	log.Printf("Player %s left game %s, waiting %s for them", playerID, gameID, h.GracePeriod)
+	h.broadcastPresence("player_disconnected", PresenceMessage{
+		GameID:   gameID,
+		PlayerID: playerID,
+		Seat:     seatOf(g, playerID),
+		GraceMs:  h.GracePeriod.Milliseconds(),
+	})
+}
+
+// expireAbsence makes a player who didn't come back forfeit
+func (h *Hub) expireAbsence(gameID, playerID string, a *absence) {
+	h.Mutex.Lock()
+	defer h.Mutex.Unlock()
+
+	key := seatKey(gameID, playerID)
+	if h.absences[key] != a {
+		return
+	}
+	delete(h.absences, key)
+
+	g, exists := h.Games[gameID]
+	if !exists || g.Status != "playing" {
+		return
+	}
+	seat := seatOf(g, playerID)
+	h.cancelBot(gameID)
+	if err := g.Forfeit(seat); err != nil {
+		return
+	}
+	log.Printf("Player %s forfeits game %s", playerID, gameID)
+
+	h.broadcastPresence("player_forfeited", PresenceMessage{GameID: gameID, PlayerID: playerID, Seat: seat})
+	h.broadcastGameUpdate(g)
+	h.finishGame(g)
+}
+
+// clearAbsences stops waiting for the absent players of g, once it's over.
+// Callers hold the lock.
+func (h *Hub) clearAbsences(g *game.Game) {
+	for _, p := range g.Players {
+		key := seatKey(g.ID, p.ID)
+		if a, ok := h.absences[key]; ok {
+			a.timer.Stop()
+			delete(h.absences, key)
+		}
+	}
+}
+
+func (h *Hub) broadcastPresence(msgType string, msg PresenceMessage) {
+	content, _ := json.Marshal(msg)
+	h.Broadcast <- RoomMessage{GameID: msg.GameID, Message: Message{Type: msgType, Content: content}}
+}
+
+// seatKey names a player's seat in a game
+func seatKey(gameID, playerID string) string {
+	return gameID + "/" + playerID
+}
+
+func newSessionToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,165 @@
+package websockethub
+
+import (
+	"connect-four/internal/game"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// takeback is a request waiting for the opponent's answer. It undoes the
+// requester's last move and anything played after it.
+type takeback struct {
+	requester string
+	target    int // number of moves left once it's accepted
+	timer     *time.Timer
+}
+
+// TakebackMessage announces a takeback request or its outcome
+type TakebackMessage struct {
+	GameID   string `json:"gameId"`
+	PlayerID string `json:"playerId"` // who asked
+	Accepted bool   `json:"accepted"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// RequestTakeback asks the opponent to let playerID take back their last
+// move. Bots accept straight away; humans have TakebackTimeout to answer.
+// Rated games never allow takebacks.
+func (h *Hub) RequestTakeback(gameID string, playerID string) error {
+	h.Mutex.Lock()
+	defer h.Mutex.Unlock()
+
+	g, exists := h.Games[gameID]
+	if !exists {
+		return &GameError{"game not found"}
+	}
+	if g.Settings.Mode == game.ModeRated {
+		return &GameError{"takebacks are not allowed in rated games"}
+	}
+	seat := seatOf(g, playerID)
+	if seat == -1 {
+		return &GameError{"not a player in this game"}
+	}
+	if g.Status != "playing" {
+		return &GameError{"game is not active"}
+	}
+	if _, pending := h.takebacks[gameID]; pending {
+		return &GameError{"a takeback is already pending"}
+	}
+
+	target := -1
+	for i := len(g.Moves) - 1; i >= 0; i-- {
+		if g.Moves[i].Player == seat {
+			target = i
+			break
+		}
+	}
+	if target == -1 {
+		return &GameError{"no move to take back"}
+	}
+
+	if g.Players[1-seat].IsBot {
+		return h.takeBack(g, playerID, target)
+	}
+
+	tb := &takeback{requester: playerID, target: target}
+	tb.timer = time.AfterFunc(h.TakebackTimeout, func() { h.expireTakeback(gameID, tb) })
+	h.takebacks[gameID] = tb
+	h.broadcastTakeback("takeback_request", TakebackMessage{GameID: gameID, PlayerID: playerID})
+	return nil
+}
+
+// RespondTakeback answers the pending takeback in a game. Only the
+// requester's opponent may answer.
+func (h *Hub) RespondTakeback(gameID string, playerID string, accept bool) error {
+	h.Mutex.Lock()
+	defer h.Mutex.Unlock()
+
+	g, exists := h.Games[gameID]
+	if !exists {
+		return &GameError{"game not found"}
+	}
+	tb, pending := h.takebacks[gameID]
+	if !pending {
+		return &GameError{"no takeback pending"}
+	}
+	if seatOf(g, playerID) == -1 || playerID == tb.requester {
+		return &GameError{"only the opponent can answer a takeback"}
+	}
+
+	h.clearTakeback(gameID)
+	if !accept {
+		h.broadcastTakeback("takeback_result", TakebackMessage{GameID: gameID, PlayerID: tb.requester, Reason: "declined"})
+		return nil
+	}
+	return h.takeBack(g, tb.requester, tb.target)
+}
+
+// takeBack undoes moves until target are left and lets a bot to move
+// think again. Callers hold the lock.
+func (h *Hub) takeBack(g *game.Game, requester string, target int) error {
+	h.cancelBot(g.ID)
+	if err := g.Undo(len(g.Moves) - target); err != nil {
+		return err
+	}
+	log.Printf("Took back moves in game %s, %d left", g.ID, target)
+
+	h.broadcastTakeback("takeback_result", TakebackMessage{GameID: g.ID, PlayerID: requester, Accepted: true})
+	h.broadcastGameUpdate(g)
+	if g.GetCurrentPlayer().IsBot {
+		go h.makeBotMove(g.ID)
+	}
+	return nil
+}
+
+// expireTakeback declines tb if it's still waiting for an answer
+func (h *Hub) expireTakeback(gameID string, tb *takeback) {
+	h.Mutex.Lock()
+	defer h.Mutex.Unlock()
+	if h.takebacks[gameID] != tb {
+		return
+	}
+	delete(h.takebacks, gameID)
+	h.broadcastTakeback("takeback_result", TakebackMessage{GameID: gameID, PlayerID: tb.requester, Reason: "timed out"})
+}
+
+// withdrawTakeback drops the game's pending takeback, if any, and tells the
+// room why. A request is for the moves played when it was made, so a move
+// played since ends it. Callers hold the lock.
+func (h *Hub) withdrawTakeback(gameID string, reason string) {
+	tb, ok := h.takebacks[gameID]
+	if !ok {
+		return
+	}
+	h.clearTakeback(gameID)
+	h.broadcastTakeback("takeback_result", TakebackMessage{GameID: gameID, PlayerID: tb.requester, Reason: reason})
+}
+
+// clearTakeback drops the game's pending takeback, if any. Callers hold the
+// lock.
+func (h *Hub) clearTakeback(gameID string) {
+	if tb, ok := h.takebacks[gameID]; ok {
+		tb.timer.Stop()
+		delete(h.takebacks, gameID)
+	}
+}
+
+func (h *Hub) broadcastTakeback(msgType string, msg TakebackMessage) {
+	content, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Error marshaling %s: %v", msgType, err)
+		return
+	}
+	h.Broadcast <- RoomMessage{GameID: msg.GameID, Message: Message{Type: msgType, Content: content}}
+}
+
+// seatOf returns playerID's seat in g, or -1
+func seatOf(g *game.Game, playerID string) int {
+	for seat, p := range g.Players {
+		if p.ID == playerID && p.ID != "" {
+			return seat
+		}
+	}
+	return -1
+}
@@ -0,0 +1,158 @@
+package websockethub
+
+import (
+	"connect-four/internal/bot"
+	"connect-four/internal/game"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// receiveTakeback returns the takeback message in the next message sent to
+// c, which must be of type msgType
+func receiveTakeback(t *testing.T, c *Client, msgType string) TakebackMessage {
+	t.Helper()
+	msg := receive(t, c)
+	if msg.Type != msgType {
+		t.Fatalf("%s got %s %s, want %s", c.PlayerID, msg.Type, msg.Content, msgType)
+	}
+	var tb TakebackMessage
+	json.Unmarshal(msg.Content, &tb)
+	return tb
+}
+
+// playedGame starts a game between two players connected through fake
+// clients, in which the first to move has played one move
+func playedGame(t *testing.T, h *Hub) (*game.Game, map[string]*Client, string) {
+	t.Helper()
+	g := startHumanGame(t, h, "p1", "p2")
+	clients := map[string]*Client{"p1": fakeClient(h, "p1", g.ID), "p2": fakeClient(h, "p2", g.ID)}
+	mover := toMove(h, g.ID)
+	send(clients[mover], "make_move", GameMessage{GameID: g.ID, Column: 3})
+	for _, c := range clients {
+		receiveGame(t, c, "game_update")
+	}
+	return g, clients, mover
+}
+
+func other(playerID string) string {
+	if playerID == "p1" {
+		return "p2"
+	}
+	return "p1"
+}
+
+func TestTakebackAccepted(t *testing.T) {
+	h := newTestHub(t)
+	h.MatchTimeout = time.Hour
+	g, clients, mover := playedGame(t, h)
+
+	send(clients[mover], "takeback_request", GameMessage{GameID: g.ID})
+	for _, c := range clients {
+		if tb := receiveTakeback(t, c, "takeback_request"); tb.PlayerID != mover {
+			t.Errorf("%s was told %s asked", c.PlayerID, tb.PlayerID)
+		}
+	}
+
+	// Only the opponent answers
+	send(clients[mover], "takeback_response", GameMessage{GameID: g.ID, Accept: true})
+	if msg := receive(t, clients[mover]); msg.Type != "error" {
+		t.Errorf("requester answering their own takeback got %s %s", msg.Type, msg.Content)
+	}
+
+	send(clients[other(mover)], "takeback_response", GameMessage{GameID: g.ID, Accept: true})
+	for _, c := range clients {
+		if tb := receiveTakeback(t, c, "takeback_result"); !tb.Accepted || tb.PlayerID != mover {
+			t.Errorf("%s was told %+v, want an accepted takeback", c.PlayerID, tb)
+		}
+		if g := receiveGame(t, c, "game_update"); len(g.Moves) != 0 || g.GetCurrentPlayer().ID != mover {
+			t.Errorf("%d moves with %s to move after the takeback", len(g.Moves), g.GetCurrentPlayer().ID)
+		}
+	}
+}
+
+func TestTakebackDeclined(t *testing.T) {
+	h := newTestHub(t)
+	h.MatchTimeout = time.Hour
+	g, clients, mover := playedGame(t, h)
+
+	send(clients[mover], "takeback_request", GameMessage{GameID: g.ID})
+	for _, c := range clients {
+		receiveTakeback(t, c, "takeback_request")
+	}
+	send(clients[other(mover)], "takeback_response", GameMessage{GameID: g.ID, Accept: false})
+	for _, c := range clients {
+		if tb := receiveTakeback(t, c, "takeback_result"); tb.Accepted || tb.Reason != "declined" {
+			t.Errorf("%s was told %+v, want a declined takeback", c.PlayerID, tb)
+		}
+		expectNothing(t, c)
+	}
+	h.Mutex.RLock()
+	moves := len(h.Games[g.ID].Moves)
+	h.Mutex.RUnlock()
+	if moves != 1 {
+		t.Errorf("%d moves after a declined takeback, want 1", moves)
+	}
+}
+
+func TestTakebackTimeout(t *testing.T) {
+	h := newTestHub(t)
+	h.MatchTimeout = time.Hour
+	h.TakebackTimeout = 50 * time.Millisecond
+	g, clients, mover := playedGame(t, h)
+
+	send(clients[mover], "takeback_request", GameMessage{GameID: g.ID})
+	for _, c := range clients {
+		receiveTakeback(t, c, "takeback_request")
+	}
+	for _, c := range clients {
+		if tb := receiveTakeback(t, c, "takeback_result"); tb.Accepted || tb.Reason != "timed out" {
+			t.Errorf("%s was told %+v, want a takeback that timed out", c.PlayerID, tb)
+		}
+	}
+
+	// The answer comes too late
+	send(clients[other(mover)], "takeback_response", GameMessage{GameID: g.ID, Accept: true})
+	if msg := receive(t, clients[other(mover)]); msg.Type != "error" {
+		t.Errorf("late answer got %s %s", msg.Type, msg.Content)
+	}
+}
+
+func TestBotAcceptsTakebacks(t *testing.T) {
+	for _, mode := range []string{game.ModeCasual, game.ModeTraining, game.ModeRated} {
+		t.Run(mode, func(t *testing.T) {
+			h := newTestHub(t)
+			g := game.NewGame("takeback_"+mode, game.Player{ID: "human", Username: "human"})
+			g.Settings.Mode = mode
+			g.AddBot(string(bot.Easy), "")
+			g.SetPosition(game.NewBoard(g.Size), 0)
+			startGame(h, g)
+			c := fakeClient(h, "human", g.ID)
+
+			if _, err := h.Play(g.ID, "human", game.Drop(3)); err != nil {
+				t.Fatal(err)
+			}
+			receiveGame(t, c, "game_update")
+			if reply := receiveGame(t, c, "game_update"); len(reply.Moves) != 2 {
+				t.Fatalf("%d moves after the bot's reply", len(reply.Moves))
+			}
+
+			err := h.RequestTakeback(g.ID, "human")
+			if mode == game.ModeRated {
+				if err == nil {
+					t.Error("took back a move in a rated game")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tb := receiveTakeback(t, c, "takeback_result"); !tb.Accepted {
+				t.Errorf("bot answered %+v", tb)
+			}
+			if back := receiveGame(t, c, "game_update"); len(back.Moves) != 0 || back.CurrentPlayer != 0 {
+				t.Errorf("%d moves with seat %d to move after the takeback", len(back.Moves), back.CurrentPlayer)
+			}
+		})
+	}
+}
@@ -4,7 +4,7 @@
 // docker-compose build backend
 // docker-compose down
 
-import { useState } from 'react';
+import { useRef, useState } from 'react';
 import GameBoard from './components/GameBoard';
 import Leaderboard from './components/LeaderBoard';
 import './App.css';
@@ -18,11 +18,17 @@ interface Player {
 
 interface Game {
   id: string;
+  size: { rows: number; columns: number; connect: number };
   board: number[][];
   players: Player[];
   currentPlayer: number;
   status: 'waiting' | 'playing' | 'finished';
   winner: number;
+  result?: string;
+}
+
+interface GameSeat extends Game {
+  sessionToken: string;
 }
 
 // Get API URLs from environment or use Render URLs
@@ -34,6 +40,10 @@ function App() {
   const [username, setUsername] = useState('');
   const [game, setGame] = useState<Game | null>(null);
   const [socket, setSocket] = useState<WebSocket | null>(null);
+  const [notice, setNotice] = useState('');
+  // Kept in refs so the socket's handlers see the latest values
+  const sessionRef = useRef('');
+  const statusRef = useRef<Game['status']>('waiting');
 
   const handleCreateGame = async () => {
     if (!username.trim()) {
@@ -50,9 +60,12 @@ function App() {
         body: JSON.stringify({ username }),
       });
 
-      const gameData: Game = await response.json();
+      const gameData: GameSeat = await response.json();
       setGame(gameData);
-      connectWebSocket(gameData.id, username);
+      setNotice('');
+      sessionRef.current = gameData.sessionToken;
+      statusRef.current = gameData.status;
+      connectWebSocket();
       setCurrentView('game');
     } catch (error) {
       console.error('Error creating game:', error);
@@ -60,8 +73,9 @@ function App() {
     }
   };
 
-  const connectWebSocket = (gameId: string, playerUsername: string) => {
-    const ws = new WebSocket(`${WS_BASE_URL}/ws?gameId=${gameId}&username=${playerUsername}`);
+  // The session token takes our seat back after a lost connection
+  const connectWebSocket = () => {
+    const ws = new WebSocket(`${WS_BASE_URL}/ws?session=${sessionRef.current}`);
     
     ws.onopen = () => {
       console.log('WebSocket connected');
@@ -72,11 +86,22 @@ function App() {
       
       if (message.type === 'game_update') {
         setGame(message.content);
+        statusRef.current = message.content.status;
+      } else if (message.type === 'player_disconnected') {
+        setNotice(`Opponent disconnected, waiting ${Math.round(message.content.graceMs / 1000)} seconds for them to return...`);
+      } else if (message.type === 'player_reconnected') {
+        setNotice('');
+      } else if (message.type === 'player_forfeited') {
+        setNotice('Opponent did not return and forfeits the game.');
       }
     };
 
     ws.onclose = () => {
       console.log('WebSocket disconnected');
+      // Reconnect unless the game is over
+      if (statusRef.current !== 'finished') {
+        setTimeout(connectWebSocket, 1000);
+      }
     };
 
     setSocket(ws);
@@ -88,7 +113,6 @@ function App() {
         type: 'make_move',
         content: {
           gameId: game.id,
-          playerId: game.players[0].id, // Assuming player is always first
           column: column,
         },
       };
@@ -140,7 +164,10 @@ function App() {
         )}
 
         {currentView === 'game' && game && (
-          <GameBoard game={game} onMove={makeMove} />
+          <>
+            {notice && <p className="waiting-note">{notice}</p>}
+            <GameBoard game={game} onMove={makeMove} />
+          </>
         )}
 
         {currentView === 'leaderboard' && (
@@ -7,8 +7,15 @@ interface Player {
   isBot: boolean;
 }
 
+interface BoardSize {
+  rows: number;
+  columns: number;
+  connect: number;
+}
+
 interface Game {
   id: string;
+  size: BoardSize;
   board: number[][];
   players: Player[];
   currentPlayer: number;
@@ -44,7 +51,7 @@ const GameBoard: React.FC<GameBoardProps> = ({ game, onMove }) => {
         className="column"
         onClick={() => !isColumnFull && onMove(colIndex)}
       >
-        {Array.from({ length: 6 }).map((_, rowIndex) =>
+        {Array.from({ length: game.size.rows }).map((_, rowIndex) =>
           renderCell(rowIndex, colIndex)
         )}
       </div>
@@ -80,11 +87,14 @@ const GameBoard: React.FC<GameBoardProps> = ({ game, onMove }) => {
             {game.players[1]?.username || 'Waiting...'}
           </div>
         </div>
+        {game.size.connect !== 4 && (
+          <div className="game-rules">Connect {game.size.connect} to win</div>
+        )}
         <div className="game-status">{getGameStatus()}</div>
       </div>
 
       <div className="board">
-        {Array.from({ length: 7 }).map((_, colIndex) =>
+        {Array.from({ length: game.size.columns }).map((_, colIndex) =>
           renderColumn(colIndex)
         )}
       </div>
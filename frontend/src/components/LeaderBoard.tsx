@@ -6,6 +6,7 @@ interface LeaderboardEntry {
   wins: number;
   losses: number;
   draws: number;
+  rating?: number;
 }
 
 // Get API URL from environment or use Render URL
@@ -79,6 +80,7 @@ const Leaderboard: React.FC = () => {
             <tr>
               <th>Rank</th>
               <th>Player</th>
+              <th>Rating</th>
               <th>Wins</th>
               <th>Losses</th>
               <th>Draws</th>
@@ -90,6 +92,7 @@ const Leaderboard: React.FC = () => {
               <tr key={entry.username || index}>
                 <td>{index + 1}</td>
                 <td>{entry.username || 'Unknown Player'}</td>
+                <td>{entry.rating ?? 1200}</td>
                 <td>{entry.wins || 0}</td>
                 <td>{entry.losses || 0}</td>
                 <td>{entry.draws || 0}</td>